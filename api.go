@@ -0,0 +1,452 @@
+package dashing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/karlseguin/gerb.v0"
+)
+
+// maxDashboardSize is the maximum size of a dashboard written through the api.
+const maxDashboardSize = 1 << 20
+
+// A dashboardEntry is a dashboard or a folder listed by the api.
+type dashboardEntry struct {
+	Path string         `json:"path"`
+	Type string         `json:"type"`
+	Meta *DashboardMeta `json:"meta,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// listDashboards returns the dashboards and folders of the asset layers
+// within a folder and its sub folders.
+func (s *Server) listDashboards(folder string) []dashboardEntry {
+	entries := []dashboardEntry{}
+	files, err := s.assets().ReadDir("dashboards", folder)
+	if err != nil {
+		return entries
+	}
+
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		rel := folder + f.Name()
+		if f.IsDir() {
+			entries = append(entries, dashboardEntry{Path: rel, Type: "folder"})
+			entries = append(entries, s.listDashboards(rel+"/")...)
+			continue
+		}
+		if !IsDashboardFile(rel) || strings.TrimSuffix(f.Name(), filepath.Ext(rel)) == "layout" {
+			continue
+		}
+		meta := s.getDashboardMeta(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		entries = append(entries, dashboardEntry{Path: meta.Path, Type: "dashboard", Meta: &meta})
+	}
+	return entries
+}
+
+// reservedDashboardName tells whether a dashboard path names a layout, or a
+// page of goDashing as _index, which the api does not write.
+func reservedDashboardName(dashboardpath string) bool {
+	name := path.Base(dashboardpath)
+	return name == "layout" || strings.HasPrefix(name, "_")
+}
+
+// checkPreconditions enforces the If-Match and If-None-Match headers against
+// the current content of a file, nil when it does not exist.
+func checkPreconditions(r *http.Request, content []byte) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if content == nil || (match != "*" && match != etagOf(content)) {
+			return false
+		}
+	}
+	if r.Header.Get("If-None-Match") == "*" && content != nil {
+		return false
+	}
+	return true
+}
+
+// APIDashboardsHandler lists every dashboard and folder.
+func (s *Server) APIDashboardsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.listDashboards(""))
+}
+
+// APIDashboardHandler serves the source of a dashboard, or lists the content
+// of a folder.
+func (s *Server) APIDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	dashboardpath := strings.TrimSuffix(param(r, "_name"), "/")
+	if !validDashboardPath(dashboardpath) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.assets().ReadDir("dashboards", dashboardpath); err == nil {
+		writeJSON(w, http.StatusOK, s.listDashboards(dashboardpath+"/"))
+		return
+	}
+
+	content, _, err := s.assets().ReadFile("dashboards", dashboardpath+s.dashboardExt(dashboardpath))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Header().Set("ETag", etagOf(content))
+	w.Write(content)
+}
+
+// APIPutDashboardHandler creates or updates a dashboard, a new one being a
+// html/template dashboard with the format=tmpl query parameter.
+func (s *Server) APIPutDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	// The body is read first, param would parse it as a form otherwise
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxDashboardSize))
+	if err != nil {
+		http.Error(w, "dashboard too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	dashboardpath := param(r, "_name")
+	if !validDashboardPath(dashboardpath) || reservedDashboardName(dashboardpath) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	ext, ok := s.findDashboard(dashboardpath)
+	if !ok {
+		ext = ".gerb"
+		if r.URL.Query().Get("format") == "tmpl" {
+			ext = ".tmpl"
+		}
+	}
+	// The dashboard is written into the webroot, shadowing the one of the
+	// next asset layers
+	file := s.webroot + "dashboards/" + dashboardpath + ext
+	current, _, err := s.assets().ReadFile("dashboards", dashboardpath+ext)
+	if err != nil {
+		current = nil
+	}
+	if !checkPreconditions(r, current) {
+		http.Error(w, "dashboard was modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etagOf(content))
+	if current == nil {
+		s.snapshot(r, dashboardpath, nil, content, "create")
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	s.snapshot(r, dashboardpath, current, content, "update")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIDeleteDashboardHandler deletes a dashboard.
+func (s *Server) APIDeleteDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	dashboardpath := param(r, "_name")
+	if !validDashboardPath(dashboardpath) || reservedDashboardName(dashboardpath) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	file := s.webroot + "dashboards/" + dashboardpath + s.dashboardExt(dashboardpath)
+	current, err := ioutil.ReadFile(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !checkPreconditions(r, current) {
+		http.Error(w, "dashboard was modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	if err := os.Remove(file); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	// The deleted content stays in the history, to be restored
+	s.snapshot(r, dashboardpath, nil, current, "delete")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIRenameDashboardHandler moves a dashboard to the path given in the
+// request body.
+func (s *Server) APIRenameDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	s.rename(w, r, true)
+}
+
+// APIPutFolderHandler creates a folder.
+func (s *Server) APIPutFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder := param(r, "_name")
+	if !validDashboardPath(folder) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	dir := s.webroot + "dashboards/" + folder
+	if f, err := os.Stat(dir); err == nil {
+		if !f.IsDir() {
+			http.Error(w, "not a folder", http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// APIDeleteFolderHandler deletes an empty folder.
+func (s *Server) APIDeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder := param(r, "_name")
+	if !validDashboardPath(folder) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	dir := s.webroot + "dashboards/" + folder
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if len(files) > 0 {
+		http.Error(w, "folder is not empty", http.StatusConflict)
+		return
+	}
+
+	if err := os.Remove(dir); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIRenameFolderHandler moves a folder to the path given in the request
+// body.
+func (s *Server) APIRenameFolderHandler(w http.ResponseWriter, r *http.Request) {
+	s.rename(w, r, false)
+}
+
+// rename moves the dashboard, or the folder when dashboard is false, of the
+// request to the path given in its body.
+func (s *Server) rename(w http.ResponseWriter, r *http.Request, dashboard bool) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	var data struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	from, to := param(r, "_name"), strings.Trim(data.Path, "/")
+	if !validDashboardPath(from) || !validDashboardPath(to) || (dashboard && (reservedDashboardName(from) || reservedDashboardName(to))) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	ext := ""
+	if dashboard {
+		ext = s.dashboardExt(from)
+		if _, ok := s.findDashboard(to); ok {
+			http.Error(w, "target already exists", http.StatusConflict)
+			return
+		}
+	}
+	source := s.webroot + "dashboards/" + from + ext
+	target := s.webroot + "dashboards/" + to + ext
+
+	f, err := os.Stat(source)
+	if err != nil || f.IsDir() != (ext == "") {
+		http.NotFound(w, r)
+		return
+	}
+	var current []byte
+	if ext != "" {
+		current, _ = ioutil.ReadFile(source)
+		if !checkPreconditions(r, current) {
+			http.Error(w, "dashboard was modified", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	if _, err := os.Stat(target); err == nil {
+		http.Error(w, "target already exists", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(source, target); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.history.Move(from, to, ext); err != nil {
+		log.Printf("History : can not move %s to %s : %s", from, to, err)
+	}
+	if ext != "" {
+		s.snapshot(r, to, nil, current, "rename from "+from)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snapshot records a change made by a request to a dashboard into its
+// history, previous being its content before the change.
+func (s *Server) snapshot(r *http.Request, dashboardpath string, previous []byte, content []byte, action string) {
+	if _, err := s.history.Record(dashboardpath, previous, content, author(r), action); err != nil {
+		log.Printf("History : can not record %s : %s", dashboardpath, err)
+	}
+}
+
+// APIHistoryHandler lists the versions of a dashboard. With a version query
+// parameter it serves the content of that version, and with from (and to,
+// the current content by default) the diff between two versions.
+func (s *Server) APIHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	dashboardpath := param(r, "_name")
+	if !validDashboardPath(dashboardpath) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Get("version") != "":
+		content, err := s.history.Content(dashboardpath, query.Get("version"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write(content)
+	case query.Get("from") != "":
+		to := query.Get("to")
+		if to == "" {
+			to = "current"
+		}
+		diff, err := s.history.Diff(dashboardpath, query.Get("from"), to)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write([]byte(diff))
+	default:
+		versions, err := s.history.Versions(dashboardpath)
+		if err != nil {
+			log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, versions)
+	}
+}
+
+// APIRestoreHandler restores the version of a dashboard given in the request
+// body.
+func (s *Server) APIRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	var data struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	dashboardpath := param(r, "_name")
+	if !validDashboardPath(dashboardpath) || data.Version == "current" {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	s.writes.Lock()
+	v, err := s.history.Restore(dashboardpath, data.Version, author(r))
+	s.writes.Unlock()
+	if err == ErrVersionNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// APIWidgetsHandler lists the widget types of the asset layers.
+func (s *Server) APIWidgetsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.assets().widgets())
+}
+
+// EditorHandler serves the dashboards editor.
+func (s *Server) EditorHandler(w http.ResponseWriter, r *http.Request) {
+	tplEditor, _, err := s.fileGetContent("_editor.gerb", "dashboards")
+	if err != nil {
+		s.serveTemplateError(w, r, &templateError{status: http.StatusNotFound, file: "dashboards/_editor.gerb", err: err, lookups: s.lookups("_editor.gerb", "dashboards")})
+		return
+	}
+
+	template, err := gerb.ParseString(true, tplEditor)
+	if err != nil {
+		s.serveTemplateError(w, r, newTemplateError(http.StatusInternalServerError, err, templateFile{"dashboards/_editor.gerb", tplEditor}))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	template.Render(w, map[string]interface{}{
+		"prefix":      s.prefix,
+		"development": s.dev,
+		"request":     r,
+	})
+}
@@ -0,0 +1,122 @@
+package dashing
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidDashboardPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"sales", true},
+		{"team/sales", true},
+		{"team/q1/sales-2017", true},
+		{"", false},
+		{"..", false},
+		{"../conf/tokens", false},
+		{"team/../../conf", false},
+		{"team/..", false},
+		{".hidden", false},
+		{"team/.git/config", false},
+		{"/etc/passwd", false},
+		{"/sales", false},
+		{"team\\sales", false},
+		{"..\\conf", false},
+		{"team//sales", false},
+		{"team/", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := validDashboardPath(tt.path); got != tt.valid {
+			t.Errorf("validDashboardPath(%q) = %v, want %v", tt.path, got, tt.valid)
+		}
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	content := []byte("<div></div>")
+	etag := etagOf(content)
+
+	tests := []struct {
+		name        string
+		ifMatch     string
+		ifNoneMatch string
+		content     []byte
+		ok          bool
+	}{
+		{"no header", "", "", content, true},
+		{"no header, missing file", "", "", nil, true},
+		{"current etag", etag, "", content, true},
+		{"other etag", `"x"`, "", content, false},
+		{"etag of a missing file", etag, "", nil, false},
+		{"any version", "*", "", content, true},
+		{"any version of a missing file", "*", "", nil, false},
+		{"create only", "", "*", nil, true},
+		{"create only, existing file", "", "*", content, false},
+		{"none match an etag", "", `"x"`, content, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PUT", "/api/dashboards/sales", nil)
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		if got := checkPreconditions(r, tt.content); got != tt.ok {
+			t.Errorf("%s : %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
+
+func TestAPIReservedDashboardNames(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/layout.gerb":      "layout",
+		"dashboards/team/layout.gerb": "layout",
+		"dashboards/_index.gerb":      "index",
+		"dashboards/sales.gerb":       "sales",
+	})
+	defer cleanup()
+	s.history = NewHistory(s.webroot)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"PUT", "layout", "x", 400},
+		{"PUT", "team/layout", "x", 400},
+		{"PUT", "_index", "x", 400},
+		{"DELETE", "layout", "", 400},
+		{"DELETE", "team/layout", "", 400},
+		{"DELETE", "_index", "", 400},
+		{"PATCH", "sales", `{"path": "layout"}`, 400},
+		{"PATCH", "sales", `{"path": "_sales"}`, 400},
+		{"PATCH", "layout", `{"path": "sales2"}`, 400},
+		{"PUT", "team/sales", "x", 201},
+		{"DELETE", "team/sales", "", 204},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/dashboards/"+tt.path+"?"+url.Values{":_name": {tt.path}}.Encode(), strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		switch tt.method {
+		case "PUT":
+			s.APIPutDashboardHandler(w, r)
+		case "PATCH":
+			s.APIRenameDashboardHandler(w, r)
+		case "DELETE":
+			s.APIDeleteDashboardHandler(w, r)
+		}
+		if w.Code != tt.status {
+			t.Errorf("%s %s : status %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+	}
+	if _, _, err := s.assets().ReadFile("dashboards", "layout.gerb"); err != nil {
+		t.Errorf("the layout is gone : %s", err)
+	}
+}
@@ -0,0 +1,393 @@
+package dashing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GeertJohan/go.rice"
+)
+
+// assetKinds are the folders of assets an overlay finds in its layers.
+var assetKinds = []string{"public", "widgets", "dashboards", "partials", "layouts"}
+
+// An AssetLayer is a root of public, widgets, dashboards, partials and
+// layouts folders. The embedded assets have no partials nor named layouts.
+type AssetLayer struct {
+	Name string `json:"name"`
+	// Path is the folder of the layer, empty for the embedded assets
+	Path string `json:"path"`
+	// Kinds are the asset folders served by the layer, all of them when
+	// empty
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// serves tells whether the layer has a kind of assets.
+func (l AssetLayer) serves(kind string) bool {
+	return len(l.Kinds) == 0 || stringInSlice(kind, l.Kinds)
+}
+
+// FS returns the files of a kind of assets of the layer, nil when it has
+// none.
+func (l AssetLayer) FS(kind string) http.FileSystem {
+	if !l.serves(kind) {
+		return nil
+	}
+	if l.Path == "" {
+		box, err := embeddedBox(kind)
+		if err != nil {
+			return nil
+		}
+		return box.HTTPBox()
+	}
+	return http.Dir(filepath.Join(l.Path, kind))
+}
+
+// location returns where the layer looks for a file of a kind of assets.
+func (l AssetLayer) location(kind string, name string) string {
+	if l.Path == "" {
+		return "assets/" + kind + "/" + name + " (embedded)"
+	}
+	return filepath.ToSlash(filepath.Join(l.Path, kind, name))
+}
+
+// embeddedBox returns the box of a kind of assets. The box names are
+// literals for rice to find them.
+func embeddedBox(kind string) (*rice.Box, error) {
+	switch kind {
+	case "public":
+		return rice.FindBox("assets/public")
+	case "widgets":
+		return rice.FindBox("assets/widgets")
+	case "dashboards":
+		return rice.FindBox("assets/dashboards")
+	}
+	return nil, fmt.Errorf("unknown asset kind %s", kind)
+}
+
+// An AssetOverlay finds the asset files in ordered layers, a file of a layer
+// shadowing the files with the same path of the next ones.
+type AssetOverlay struct {
+	Layers []AssetLayer `json:"layers"`
+}
+
+// NewAssetOverlay returns the layers of a webroot : the webroot itself, the
+// [[layer]] tables of conf/assets.toml, in order, then the embedded assets.
+// A relative layer path is relative to the webroot. When the configuration is
+// invalid, the overlay has the webroot and the embedded assets only.
+func NewAssetOverlay(webroot string) (*AssetOverlay, error) {
+	webrootLayer := AssetLayer{Name: "webroot", Path: webroot}
+	embeddedLayer := AssetLayer{Name: "embedded"}
+	o := &AssetOverlay{Layers: []AssetLayer{webrootLayer, embeddedLayer}}
+
+	if _, err := os.Stat(webroot + "conf/assets.toml"); err != nil {
+		return o, nil
+	}
+	var conf struct {
+		Layer []AssetLayer
+	}
+	if _, err := toml.DecodeFile(webroot+"conf/assets.toml", &conf); err != nil {
+		return o, err
+	}
+
+	names := []string{webrootLayer.Name, embeddedLayer.Name}
+	for i, l := range conf.Layer {
+		if l.Path == "" {
+			return o, fmt.Errorf("layer %d : a path is required", i+1)
+		}
+		if !filepath.IsAbs(l.Path) {
+			l.Path = filepath.Join(webroot, l.Path)
+		}
+		l.Path = filepath.Clean(l.Path) + string(filepath.Separator)
+		if l.Name == "" {
+			l.Name = filepath.ToSlash(l.Path)
+		}
+		if stringInSlice(l.Name, names) {
+			return o, fmt.Errorf("layer %s : the name is already used", l.Name)
+		}
+		for _, kind := range l.Kinds {
+			if !stringInSlice(kind, assetKinds) {
+				return o, fmt.Errorf("layer %s : unknown kind %q, expected public, widgets, dashboards, partials or layouts", l.Name, kind)
+			}
+		}
+		names = append(names, l.Name)
+		conf.Layer[i] = l
+	}
+
+	o.Layers = append([]AssetLayer{webrootLayer}, append(conf.Layer, embeddedLayer)...)
+	return o, nil
+}
+
+// loadAssetOverlay returns the layers of a webroot, logging an invalid
+// configuration.
+func loadAssetOverlay(webroot string) *AssetOverlay {
+	o, err := NewAssetOverlay(webroot)
+	if err != nil {
+		log.Printf("Assets : invalid conf/assets.toml : %s", err)
+	}
+	return o
+}
+
+// open opens a file of a kind of assets of a layer, failing on a folder.
+func (l AssetLayer) open(kind string, name string) (http.File, error) {
+	fs := l.FS(kind)
+	if fs == nil {
+		return nil, os.ErrNotExist
+	}
+	f, err := fs.Open(path.Clean("/" + name))
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
+
+// hasDir tells whether a layer has a folder of a kind of assets.
+func (l AssetLayer) hasDir(kind string, name string) bool {
+	fs := l.FS(kind)
+	if fs == nil {
+		return false
+	}
+	f, err := fs.Open(path.Clean("/" + name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return err == nil && fi.IsDir()
+}
+
+// Open opens a file of a kind of assets, from the first layer having it.
+func (o *AssetOverlay) Open(kind string, name string) (http.File, AssetLayer, error) {
+	for _, l := range o.Layers {
+		if f, err := l.open(kind, name); err == nil {
+			return f, l, nil
+		}
+	}
+	return nil, AssetLayer{}, &os.PathError{Op: "open", Path: kind + "/" + name, Err: os.ErrNotExist}
+}
+
+// ReadFile returns the content of a file of a kind of assets, and the layer
+// serving it.
+func (o *AssetOverlay) ReadFile(kind string, name string) ([]byte, AssetLayer, error) {
+	for _, l := range o.Layers {
+		if content, err := l.readFile(kind, name); err == nil {
+			return content, l, nil
+		}
+	}
+	return nil, AssetLayer{}, &os.PathError{Op: "open", Path: kind + "/" + name, Err: os.ErrNotExist}
+}
+
+// lookups returns the locations tried for a file of a kind of assets.
+func (o *AssetOverlay) lookups(kind string, name string) []string {
+	locations := []string{}
+	for _, l := range o.Layers {
+		if l.serves(kind) {
+			locations = append(locations, l.location(kind, name))
+		}
+	}
+	return locations
+}
+
+// ReadDir lists the files and folders of a folder of a kind of assets of the
+// layers on disk, sorted by name, an entry of a layer shadowing the ones with
+// the same name of the next layers. The embedded files, defaults served by
+// their name, are not listed.
+func (o *AssetOverlay) ReadDir(kind string, dir string) ([]os.FileInfo, error) {
+	entries := map[string]os.FileInfo{}
+	found := false
+	for _, l := range o.Layers {
+		fs := l.FS(kind)
+		if fs == nil || l.Path == "" {
+			continue
+		}
+		f, err := fs.Open(path.Clean("/" + dir))
+		if err != nil {
+			continue
+		}
+		list, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, e := range list {
+			if _, ok := entries[e.Name()]; !ok {
+				entries[e.Name()] = e
+			}
+		}
+	}
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: kind + "/" + dir, Err: os.ErrNotExist}
+	}
+
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := []os.FileInfo{}
+	for _, name := range names {
+		list = append(list, entries[name])
+	}
+	return list, nil
+}
+
+// An AssetFile is a file of an overlay, with the layer serving it and the
+// next layers it shadows.
+type AssetFile struct {
+	Path     string   `json:"path"`
+	Layer    string   `json:"layer"`
+	Shadowed []string `json:"shadowed,omitempty"`
+}
+
+// dashboardFiles returns the dashboard files of the layers on disk, as paths
+// relative to their dashboards folders.
+func (s *Server) dashboardFiles() []string {
+	names := []string{}
+	for _, f := range s.assets().Files("dashboards", "") {
+		if f.Layer != "embedded" && IsDashboardFile(f.Path) {
+			names = append(names, f.Path)
+		}
+	}
+	return names
+}
+
+// DashboardFiles returns the dashboard files of the asset layers of a
+// webroot, as paths relative to their dashboards folders.
+func DashboardFiles(webroot string) []string {
+	return serverOf(webroot).dashboardFiles()
+}
+
+// walkFS calls fn with the path of each file below a folder of a file
+// system.
+func walkFS(fs http.FileSystem, dir string, fn func(name string)) {
+	f, err := fs.Open(path.Clean("/" + dir))
+	if err != nil {
+		return
+	}
+	entries, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if e.IsDir() {
+			walkFS(fs, name, fn)
+		} else {
+			fn(name)
+		}
+	}
+}
+
+// Files lists the files of a kind of assets below a folder, sorted by path.
+func (o *AssetOverlay) Files(kind string, dir string) []AssetFile {
+	files := map[string]*AssetFile{}
+	for _, l := range o.Layers {
+		fs := l.FS(kind)
+		if fs == nil {
+			continue
+		}
+		walkFS(fs, dir, func(name string) {
+			if f, ok := files[name]; ok {
+				f.Shadowed = append(f.Shadowed, l.Name)
+				return
+			}
+			files[name] = &AssetFile{Path: name, Layer: l.Name}
+		})
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []AssetFile{}
+	for _, name := range names {
+		list = append(list, *files[name])
+	}
+	return list
+}
+
+// files returns the files of a kind of assets below a folder of the layer,
+// sorted by path.
+func (l AssetLayer) files(kind string, dir string) []string {
+	names := []string{}
+	if fs := l.FS(kind); fs != nil {
+		walkFS(fs, dir, func(name string) {
+			names = append(names, name)
+		})
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readFile returns the content of a file of a kind of assets of the layer.
+func (l AssetLayer) readFile(kind string, name string) ([]byte, error) {
+	f, err := l.open(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// SetAssets sets the asset layers and the cache policy of the public files,
+// read from the webroot otherwise. It is called before serving.
+func (s *Server) SetAssets(o *AssetOverlay, policy CachePolicy) {
+	s.confOnce.Do(func() {
+		s.overlay = o
+		s.staticCache = policy
+	})
+}
+
+// loadConf reads the asset layers and the cache policy of the webroot, once.
+func (s *Server) loadConf() {
+	s.confOnce.Do(func() {
+		s.overlay = loadAssetOverlay(s.webroot)
+		policy, err := ReadCachePolicy(s.webroot)
+		if err != nil {
+			log.Printf("Static : invalid conf/static.toml : %s", err)
+		}
+		s.staticCache = policy
+	})
+}
+
+// assets returns the asset layers of the webroot.
+func (s *Server) assets() *AssetOverlay {
+	s.loadConf()
+	return s.overlay
+}
+
+// APIAssetsHandler lists the asset layers, and the files of each kind of
+// assets with the layer serving them, ?kind=widgets listing only a kind.
+func (s *Server) APIAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	kinds := assetKinds
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		if !stringInSlice(kind, assetKinds) {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		kinds = []string{kind}
+	}
+
+	files := map[string][]AssetFile{}
+	for _, kind := range kinds {
+		files[kind] = s.assets().Files(kind, "")
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"layers": s.assets().Layers,
+		"files":  files,
+	})
+}
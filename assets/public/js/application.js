@@ -23532,7 +23532,7 @@ var toObject = function (o) {
 
   Dashing.debugMode = false;
 
-  source = new EventSource('events');
+  source = new EventSource(window.DashingEvents || 'events');
 
   source.addEventListener('open', function(e) {
     return console.log("Connection opened", e);
@@ -23574,7 +23574,7 @@ var toObject = function (o) {
     if (Dashing.debugMode) {
       console.log("Received data for dashboards", data);
     }
-    if (data.dashboard === '*' || window.location.pathname === ("/" + data.dashboard)) {
+    if (data.dashboard === '*' || window.location.pathname === ("/" + data.dashboard) || document.body.getAttribute('data-dashboard') === data.dashboard) {
       return Dashing.fire(data.event, data);
     }
   });
@@ -42014,6 +42014,13 @@ Rickshaw.Series.FixedDuration = Rickshaw.Class.create(Rickshaw.Series, {
     contentWidth = (Dashing.widget_base_dimensions[0] + Dashing.widget_margins[0] * 2) * Dashing.numColumns;
     return Batman.setImmediate(function() {
       $('.gridster').width(contentWidth);
+      $('.gridster ul:first > li').each(function() {
+        var li = $(this), widget = li.children('[data-sizex]').first();
+        if (widget.length && !li.attr('data-sizex')) {
+          li.attr('data-sizex', widget.attr('data-sizex'));
+          li.attr('data-sizey', widget.attr('data-sizey'));
+        }
+      });
       return $('.gridster ul:first').gridster({
         widget_margins: Dashing.widget_margins,
         widget_base_dimensions: Dashing.widget_base_dimensions,
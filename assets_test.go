@@ -0,0 +1,189 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, by path, below a folder.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewAssetOverlay(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   string
+		layers string
+		err    string
+	}{
+		{"no configuration", "", "webroot embedded", ""},
+		{"layers in order", "[[layer]]\nname = \"team\"\npath = \"team\"\n[[layer]]\nname = \"charts\"\npath = \"charts\"\nkinds = [\"widgets\"]\n", "webroot team charts embedded", ""},
+		{"named after the path", "[[layer]]\npath = \"team\"\n", "webroot team/ embedded", ""},
+		{"path required", "[[layer]]\nname = \"team\"\n", "webroot embedded", "a path is required"},
+		{"name used", "[[layer]]\nname = \"embedded\"\npath = \"team\"\n", "webroot embedded", "the name is already used"},
+		{"unknown kind", "[[layer]]\nname = \"team\"\npath = \"team\"\nkinds = [\"themes\"]\n", "webroot embedded", "unknown kind"},
+		{"invalid toml", "[[layer]\n", "webroot embedded", "line 1"},
+	}
+	for _, tt := range tests {
+		webroot, err := ioutil.TempDir("", "overlay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		webroot += string(filepath.Separator)
+		if tt.conf != "" {
+			writeFiles(t, webroot, map[string]string{"conf/assets.toml": tt.conf})
+		}
+
+		o, err := NewAssetOverlay(webroot)
+		os.RemoveAll(webroot)
+		if err == nil && tt.err != "" || err != nil && (tt.err == "" || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s : error %v, want %q", tt.name, err, tt.err)
+		}
+		names := []string{}
+		for _, l := range o.Layers {
+			names = append(names, strings.TrimPrefix(filepath.ToSlash(l.Name), filepath.ToSlash(webroot)))
+		}
+		if got := strings.Join(names, " "); got != tt.layers {
+			t.Errorf("%s : layers %q, want %q", tt.name, got, tt.layers)
+		}
+	}
+}
+
+func TestAssetOverlayLookups(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"conf/assets.toml":                "[[layer]]\nname = \"team\"\npath = \"team\"\n[[layer]]\nname = \"charts\"\npath = \"charts\"\nkinds = [\"widgets\"]\n",
+		"public/site.css":                 "webroot",
+		"dashboards/main.gerb":            "webroot",
+		"team/public/site.css":            "team",
+		"team/public/team.css":            "team",
+		"team/dashboards/main.gerb":       "team",
+		"team/dashboards/ops/room.gerb":   "team",
+		"team/partials/tile.gerb":         "team",
+		"team/widgets/Gauge/Gauge.js":     "team",
+		"charts/widgets/Gauge/Gauge.js":   "charts",
+		"charts/widgets/Chart/Chart.js":   "charts",
+		"charts/public/ignored.css":       "charts",
+		"charts/dashboards/ignored.gerb":  "charts",
+		"team/dashboards/ops/folder.toml": "namespace = \"ops\"\n",
+		"team/public/js/application.js":   "team",
+		"team/layouts/wide.gerb":          "team",
+		"layouts/narrow.gerb":             "webroot",
+		"charts/layouts/ignored.gerb":     "charts",
+	})
+	defer cleanup()
+	o := s.assets()
+
+	files := []struct {
+		kind  string
+		name  string
+		layer string
+	}{
+		{"public", "site.css", "webroot"},
+		{"public", "team.css", "team"},
+		{"public", "js/application.js", "team"},
+		{"public", "css/application.css", "embedded"},
+		{"public", "ignored.css", ""},
+		{"dashboards", "main.gerb", "webroot"},
+		{"dashboards", "ops/room.gerb", "team"},
+		{"dashboards", "ignored.gerb", ""},
+		{"dashboards", "layout.gerb", "embedded"},
+		{"partials", "tile.gerb", "team"},
+		{"widgets", "Gauge/Gauge.js", "team"},
+		{"widgets", "Chart/Chart.js", "charts"},
+		{"widgets", "number/number.html", "embedded"},
+		{"widgets", "Number/Number.js", ""},
+		{"dashboards", "ops", ""},
+		{"public", "../conf/assets.toml", ""},
+		{"layouts", "wide.gerb", "team"},
+		{"layouts", "narrow.gerb", "webroot"},
+		{"layouts", "ignored.gerb", ""},
+		{"layouts", "../dashboards/main.gerb", ""},
+	}
+	for _, tt := range files {
+		content, layer, err := o.ReadFile(tt.kind, tt.name)
+		if tt.layer == "" {
+			if err == nil {
+				t.Errorf("%s/%s : found in %s, want none", tt.kind, tt.name, layer.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s : %s, want the %s layer", tt.kind, tt.name, err, tt.layer)
+			continue
+		}
+		if layer.Name != tt.layer {
+			t.Errorf("%s/%s : found in %s, want %s", tt.kind, tt.name, layer.Name, tt.layer)
+		}
+		if layer.Path != "" && string(content) != tt.layer {
+			t.Errorf("%s/%s : content %q, want the one of %s", tt.kind, tt.name, content, tt.layer)
+		}
+	}
+
+	entries, err := o.ReadDir("dashboards", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"main.gerb", "ops"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir(dashboards) = %v, want %v", names, want)
+	}
+	if _, err := o.ReadDir("dashboards", "nope"); err == nil {
+		t.Errorf("ReadDir of a missing folder : no error")
+	}
+
+	if got, want := s.dashboardFiles(), []string{"main.gerb", "ops/room.gerb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dashboardFiles() = %v, want %v", got, want)
+	}
+
+	for _, f := range o.Files("widgets", "Gauge") {
+		if f.Path == "Gauge/Gauge.js" {
+			if f.Layer != "team" || !reflect.DeepEqual(f.Shadowed, []string{"charts"}) {
+				t.Errorf("Files : %s served by %s shadowing %v, want team shadowing [charts]", f.Path, f.Layer, f.Shadowed)
+			}
+		}
+	}
+}
+
+func TestGetNamedLayout(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"conf/assets.toml":       "[[layer]]\nname = \"team\"\npath = \"team\"\n",
+		"team/layouts/wide.gerb": "team",
+		"layouts/narrow.gerb":    "webroot",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{"wide", "team", false},
+		{"narrow", "webroot", false},
+		{"missing", "", true},
+		{"../dashboards/layout", "", true},
+	}
+	for _, tt := range tests {
+		content, file, err := s.getLayout("sales", tt.name, ".gerb")
+		if (err != nil) != tt.err {
+			t.Errorf("%s : error %v, want an error %v", tt.name, err, tt.err)
+			continue
+		}
+		if content != tt.content || !tt.err && file != "layouts/"+tt.name+".gerb" {
+			t.Errorf("%s : %q from %s, want %q", tt.name, content, file, tt.content)
+		}
+	}
+}
@@ -1,74 +1,176 @@
 package dashing
 
+import (
+	"sync"
+	"time"
+)
+
 // An eventCache stores the latest event for each key, so that new clients can
 // catch up.
 type eventCache map[string]*Event
 
+// A client is an attached SSE connection, optionally identified by the name
+// of the screen displaying it.
+type client struct {
+	events chan *Event
+	screen string
+	// id of the client cookie
+	id         string
+	remoteAddr string
+	userAgent  string
+	dashboard  string
+	// namespace of the widget IDs of the dashboard, "" for the global one
+	namespace string
+}
+
 // A Broker broadcasts events to multiple clients.
 type Broker struct {
-	// Create a map of clients, the keys of the map are the channels
-	// over which we can push messages to attached clients. (The values
-	// are just booleans and are meaningless)
-	clients map[chan *Event]bool
+	// Create a map of clients, the keys of the map are the clients
+	// to which we can push messages. (The values are just booleans
+	// and are meaningless)
+	clients map[*client]bool
 
 	// Channel into which new clients can be pushed
-	newClients chan chan *Event
+	newClients chan *client
 
 	// Channel into which disconnected clients should be pushed
-	defunctClients chan chan *Event
+	defunctClients chan *client
 
 	// Channel into which events are pushed to be broadcast out
 	// to attached clients
 	events chan *Event
 
-	// Cache for most recent events with a certain ID
-	cache eventCache
+	// Cache for most recent events with a certain ID, read by the
+	// server when rotating dashboards
+	cache     eventCache
+	cacheLock sync.RWMutex
+
+	// Registry of the screens which are, or were, connected
+	screens *screenRegistry
 }
 
 // Start managing client connections and event broadcasts.
 func (b *Broker) Start() {
 	go func() {
+		ticker := time.NewTicker(30 * time.Second)
 		for {
 			// Block until we receive from one of the
-			// three following channels.
+			// four following channels.
 			select {
-			case s := <-b.newClients:
+			case c := <-b.newClients:
 				// There is a new client attached and we
 				// want to start sending them events.
-				b.clients[s] = true
+				b.clients[c] = true
+				b.screens.connect(c)
 				// Send all the cached events so that when a new client connects, it
 				// doesn't miss previous events
 				//log.Println("sending cache")
 				for _, e := range b.cache {
-					s <- e
+					if b.visible(c, e) {
+						c.events <- e
+					}
 				}
+				b.broadcastScreens()
 				//log.Println("Added new client")
-			case s := <-b.defunctClients:
+			case c := <-b.defunctClients:
 				// A client has detached and we want to
 				// stop sending them events.
-				delete(b.clients, s)
+				delete(b.clients, c)
+				b.screens.disconnect(c)
+				b.broadcastScreens()
 				//log.Println("Removed client")
 			case event := <-b.events:
-				b.cache[event.ID] = event
-				// There is a new event to send. For each
-				// attached client, push the new event
-				// into the client's channel.
-				for s := range b.clients {
-					s <- event
-				}
-				//log.Printf("Broadcast event to %d clients", len(b.clients))
+				b.broadcast(event)
+			case <-ticker.C:
+				// Refresh the last seen dates of the screens dashboard.
+				b.screens.expire(time.Now())
+				b.broadcastScreens()
 			}
 		}
 	}()
 }
 
+func (b *Broker) broadcast(event *Event) {
+	// Events addressed to the dashboards, or to a single screen, are
+	// commands, replaying them to clients connecting later would make
+	// them reload, and so on.
+	if event.Target == "" && event.Screen == "" {
+		b.cacheLock.Lock()
+		b.cache[namespacedID(event.Namespace, event.ID)] = event
+		b.cacheLock.Unlock()
+	}
+	// There is a new event to send. For each
+	// attached client, push the new event
+	// into the client's channel.
+	for c := range b.clients {
+		if event.Screen != "" && event.Screen != c.screen {
+			continue
+		}
+		if !b.visible(c, event) {
+			continue
+		}
+		c.events <- event
+	}
+	//log.Printf("Broadcast event to %d clients", len(b.clients))
+}
+
+func (b *Broker) broadcastScreens() {
+	for _, e := range b.screens.events() {
+		b.broadcast(e)
+	}
+}
+
+// namespacedID returns the key of a widget ID of a namespace.
+func namespacedID(namespace string, id string) string {
+	if namespace == "" {
+		return id
+	}
+	return namespace + "/" + id
+}
+
+// visible tells whether a widget event reaches a client : the events of a
+// namespace reach its dashboards only, the global ones reach every dashboard
+// whose namespace has no event with the same ID. Called by the broker
+// goroutine, the only writer of the cache.
+func (b *Broker) visible(c *client, event *Event) bool {
+	if event.Target != "" {
+		return true
+	}
+	if event.Namespace != "" {
+		return event.Namespace == c.namespace
+	}
+	if c.namespace == "" {
+		return true
+	}
+	_, shadowed := b.cache[namespacedID(c.namespace, event.ID)]
+	return !shadowed
+}
+
+// cached returns the most recent event with the given ID, in a namespace
+// first.
+func (b *Broker) cached(namespace string, id string) (*Event, bool) {
+	b.cacheLock.RLock()
+	defer b.cacheLock.RUnlock()
+	if e, ok := b.cache[namespacedID(namespace, id)]; ok {
+		return e, ok
+	}
+	e, ok := b.cache[id]
+	return e, ok
+}
+
+// Screens returns the screens which are, or were, connected to the broker.
+func (b *Broker) Screens() []Screen {
+	return b.screens.list()
+}
+
 // NewBroker creates a Broker instance.
 func NewBroker() *Broker {
 	return &Broker{
-		make(map[chan *Event]bool),
-		make(chan (chan *Event)),
-		make(chan (chan *Event)),
-		make(chan *Event),
-		map[string]*Event{},
+		clients:        make(map[*client]bool),
+		newClients:     make(chan *client),
+		defunctClients: make(chan *client),
+		events:         make(chan *Event),
+		cache:          map[string]*Event{},
+		screens:        newScreenRegistry(),
 	}
 }
@@ -0,0 +1,120 @@
+package dashing
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBrokerNamespaces(t *testing.T) {
+	b := NewBroker()
+	global := &client{events: make(chan *Event, 10)}
+	ops := &client{events: make(chan *Event, 10), namespace: "ops"}
+	sales := &client{events: make(chan *Event, 10), namespace: "sales"}
+	lobby := &client{events: make(chan *Event, 10), screen: "lobby", namespace: "ops"}
+	for _, c := range []*client{global, ops, sales, lobby} {
+		b.clients[c] = true
+	}
+	received := func(c *client) string {
+		ids := []string{}
+		for len(c.events) > 0 {
+			e := <-c.events
+			ids = append(ids, namespacedID(e.Namespace, e.ID))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	event := func(namespace string, id string, target string, screen string) *Event {
+		e := NewEvent(id, map[string]interface{}{}, target)
+		e.Namespace, e.Screen = namespace, screen
+		return e
+	}
+	b.broadcast(event("", "load", "", ""))
+	b.broadcast(event("ops", "load", "", ""))
+	b.broadcast(event("", "load", "", ""))
+	b.broadcast(event("", "free", "", ""))
+	b.broadcast(event("", "reload", "dashboards", ""))
+	b.broadcast(event("", "reload", "dashboards", "lobby"))
+
+	tests := []struct {
+		name   string
+		client *client
+		want   string
+	}{
+		{"global dashboard", global, "load load free reload"},
+		{"namespace shadowing a global id once it has an event", ops, "load ops/load free reload"},
+		{"other namespace", sales, "load load free reload"},
+		{"screen of a namespace", lobby, "load ops/load free reload reload"},
+	}
+	for _, tt := range tests {
+		if got := received(tt.client); got != tt.want {
+			t.Errorf("%s : received %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The cache replayed to the clients connecting later
+	replayed := func(c *client) string {
+		ids := []string{}
+		for _, key := range []string{"load", "ops/load", "free", "reload"} {
+			if e, ok := b.cache[key]; ok && b.visible(c, e) {
+				ids = append(ids, key)
+			}
+		}
+		return strings.Join(ids, " ")
+	}
+	if got, want := replayed(ops), "ops/load free"; got != want {
+		t.Errorf("replayed to ops : %q, want %q", got, want)
+	}
+	if got, want := replayed(sales), "load free"; got != want {
+		t.Errorf("replayed to sales : %q, want %q", got, want)
+	}
+	if e, ok := b.cached("ops", "load"); !ok || e.Namespace != "ops" {
+		t.Errorf("cached(ops, load) = %v, want the event of ops", e)
+	}
+	if e, ok := b.cached("sales", "load"); !ok || e.Namespace != "" {
+		t.Errorf("cached(sales, load) = %v, want the global event", e)
+	}
+}
+
+func TestWidgetEventRoutes(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+	s.broker = NewBroker()
+	s.validation = ValidationOff
+	router := s.NewRouter()
+
+	tests := []struct {
+		path      string
+		body      string
+		status    int
+		namespace string
+		id        string
+	}{
+		{"/widgets/load", `{"value": 1}`, 204, "", "load"},
+		{"/widgets/ops/load", `{"value": 1}`, 204, "ops", "load"},
+		{"/widgets/ops/load/x", `{"value": 1}`, 400, "", ""},
+		{"/widgets/o%20ps/load", `{"value": 1}`, 400, "", ""},
+		{"/widgets/ops/", `{"value": 1}`, 400, "", ""},
+		{"/widgets/load", `{"value":`, 400, "", ""},
+	}
+	for _, tt := range tests {
+		events := make(chan *Event, 1)
+		go func() { events <- <-s.broker.events }()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.path, w.Code, tt.status)
+		}
+		if tt.status != 204 {
+			s.broker.events <- nil
+			<-events
+			continue
+		}
+		if e := <-events; e.Namespace != tt.namespace || e.ID != tt.id {
+			t.Errorf("%s : event %s of namespace %q, want %s of %q", tt.path, e.ID, e.Namespace, tt.id, tt.namespace)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package dashing
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dashboardViews returns the widget types of a dashboard, its parameters,
+// partials and helpers being expanded, and of its layout.
+func (s *Server) dashboardViews(dashboardpath string) ([]string, error) {
+	ext, ok := s.findDashboard(dashboardpath)
+	if !ok {
+		return nil, fmt.Errorf("dashboard %s not found", dashboardpath)
+	}
+	variants, err := s.dashboardVariants(dashboardpath + ext)
+	if err != nil {
+		return nil, err
+	}
+	if layout, _, err := s.getLayout(dashboardpath, s.getDashboardMeta(dashboardpath).Layout, ext); err == nil {
+		variants = append(variants, layout)
+	}
+
+	views := []string{}
+	for _, variant := range variants {
+		for _, m := range widgetViewRegex.FindAllStringSubmatch(variant, -1) {
+			if !stringInSlice(m[1], views) {
+				views = append(views, m[1])
+			}
+		}
+	}
+	sort.Strings(views)
+	return views, nil
+}
+
+// scriptWidgets returns the widgets without a view, as the switcher, whose
+// scripts serve every dashboard.
+func (s *Server) scriptWidgets() []string {
+	names := []string{}
+	for _, w := range s.assets().widgets() {
+		if !s.widgetExists(w.Name) {
+			names = append(names, w.Name)
+		}
+	}
+	return names
+}
+
+// dashboardBundle returns the minified files of a kind of the widgets of a
+// dashboard.
+func (s *Server) dashboardBundle(dashboardpath string, ext string) (*bundle, error) {
+	if !validDashboardPath(dashboardpath) {
+		return nil, fmt.Errorf("invalid dashboard %s", dashboardpath)
+	}
+	file, _ := s.resolveDashboard(dashboardpath)
+	v, err := s.fromCache("widgets"+ext+":"+file, func() (interface{}, error) {
+		views, err := s.dashboardViews(file)
+		if err != nil {
+			return nil, err
+		}
+		content := s.buildWidgetsBundleOf(append(s.scriptWidgets(), views...), ext)
+		if ext == ".js" {
+			return newBundle(minifyJS(content)), nil
+		}
+		return newBundle(minifyCSS(content)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*bundle), nil
+}
+
+// version returns the hash of a bundle, busting the caches of its url.
+func (b *bundle) version() string {
+	return strings.Trim(b.etag, `"`)[:10]
+}
+
+// widgetsURL returns the url of the widgets bundle of a kind of a dashboard,
+// versioned by its hash, or of every widget when it can not be built.
+func (s *Server) widgetsURL(dashboardpath string, ext string) string {
+	b, err := s.dashboardBundle(dashboardpath, ext)
+	if err != nil {
+		return s.prefix + "/widgets" + ext
+	}
+	return fmt.Sprintf("%s/widgets%s?dashboard=%s&v=%s", s.prefix, ext, url.QueryEscape(dashboardpath), b.version())
+}
+
+// serveWidgetsBundle serves the files of a kind of the widgets of the
+// dashboard query parameter, or of every widget without one. A bundle asked
+// with its current version is cached for good.
+func (s *Server) serveWidgetsBundle(w http.ResponseWriter, r *http.Request, ext string) {
+	dashboard := r.URL.Query().Get("dashboard")
+	if dashboard == "" {
+		v, _ := s.fromCache("widgets"+ext, func() (interface{}, error) {
+			return newBundle(s.buildWidgetsBundle(ext)), nil
+		})
+		v.(*bundle).serve(w, r)
+		return
+	}
+
+	b, err := s.dashboardBundle(dashboard, ext)
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "widgets"+ext, err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("v") == b.version() {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	b.serve(w, r)
+}
+
+// isIdentChar tells whether a byte can be part of a javascript identifier or
+// number.
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c == '\\' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// regexpKeywords are the keywords after which a slash starts a regular
+// expression.
+var regexpKeywords = []string{"return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw"}
+
+// minifyJS removes the comments, the indentation and the blank lines of a
+// script. Line breaks are kept, except after an opening bracket, a comma or a
+// semicolon, so that automatic semicolon insertion still applies.
+func minifyJS(src []byte) []byte {
+	var out bytes.Buffer
+	var space, newline bool
+	last := byte('\n')
+
+	// regexpAllowed tells whether a slash starts a regular expression,
+	// after the last byte written
+	regexpAllowed := func() bool {
+		if strings.IndexByte("(,=:[!&|?{;+-*%<>~^\n", last) != -1 {
+			return true
+		}
+		o := out.Bytes()
+		for _, k := range regexpKeywords {
+			if bytes.HasSuffix(o, []byte(k)) && (len(o) == len(k) || !isIdentChar(o[len(o)-len(k)-1])) {
+				return true
+			}
+		}
+		return false
+	}
+
+	emit := func(c byte) {
+		switch {
+		case newline && out.Len() > 0 && strings.IndexByte("{[(,;", last) == -1:
+			out.WriteByte('\n')
+			last = '\n'
+		case space && (isIdentChar(last) && isIdentChar(c) || last == c && (c == '+' || c == '-')):
+			out.WriteByte(' ')
+		}
+		space, newline = false, false
+		out.WriteByte(c)
+		last = c
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\n' || c == '\r':
+			newline = true
+		case c == ' ' || c == '\t' || c == '\f' || c == '\v':
+			space = true
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			newline = true
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(src)
+				break
+			}
+			if bytes.ContainsAny(src[i+2:i+2+end], "\n\r") {
+				newline = true
+			} else {
+				space = true
+			}
+			i += end + 3
+		case c == '"' || c == '\'' || c == '`' || c == '/' && regexpAllowed():
+			// Strings, templates and regular expressions are copied as is
+			emit(c)
+			class := false
+			for i++; i < len(src); i++ {
+				out.WriteByte(src[i])
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					out.WriteByte(src[i])
+					continue
+				}
+				if c == '/' && src[i] == '[' {
+					class = true
+				} else if c == '/' && src[i] == ']' {
+					class = false
+				} else if src[i] == c && !class {
+					break
+				} else if src[i] == '\n' && c != '`' {
+					break
+				}
+			}
+			last = c
+		default:
+			emit(c)
+		}
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// minifyCSS removes the comments and the spaces of a stylesheet which do not
+// separate anything.
+func minifyCSS(src []byte) []byte {
+	var out bytes.Buffer
+	space := false
+	last := byte('{')
+	const tight = "{};,>"
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(src)
+				break
+			}
+			i += end + 3
+			space = true
+		default:
+			if space && strings.IndexByte(tight, last) == -1 && strings.IndexByte(tight, c) == -1 {
+				out.WriteByte(' ')
+			}
+			space = false
+			if c == '}' && last == ';' {
+				out.Truncate(out.Len() - 1)
+			}
+			out.WriteByte(c)
+			last = c
+			if c == '"' || c == '\'' {
+				for i++; i < len(src); i++ {
+					out.WriteByte(src[i])
+					if src[i] == '\\' && i+1 < len(src) {
+						i++
+						out.WriteByte(src[i])
+					} else if src[i] == c {
+						break
+					}
+				}
+			}
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,146 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"comments", "a = 1; // one\n/* two */ b = 2", "a=1;b=2\n"},
+		{"indentation", "if (a) {\n    b();\n}\n", "if(a){b();}\n"},
+		{"automatic semicolons", "a = 1\nb = 2\n\n\nc()", "a=1\nb=2\nc()\n"},
+		{"identifiers", "var a = typeof b", "var a=typeof b\n"},
+		{"unary operators", "a = b - -c + +d", "a=b- -c+ +d\n"},
+		{"strings", `s = "http://x" + '/* y */' // z`, "s=\"http://x\"+'/* y */'\n"},
+		{"template", "s = `a\n  // b`", "s=`a\n  // b`\n"},
+		{"regexp", `x = /a\/b[/]c/g.test(s) // d`, "x=/a\\/b[/]c/g.test(s)\n"},
+		{"regexp after return", "return /x/.test(s)", "return/x/.test(s)\n"},
+		{"division", "a = b / c / 2 // it's", "a=b/c/2\n"},
+		{"division after a parenthesis", "a = (b) / 2 // it's", "a=(b)/2\n"},
+		{"division after a bracket", "a = b[0] / 2 // it's", "a=b[0]/2\n"},
+		{"division after a brace", "a = {}.b || {} / 2 // it's", "a={}.b||{}/2\n"},
+	}
+	for _, tt := range tests {
+		if got := string(minifyJS([]byte(tt.src))); got != tt.want {
+			t.Errorf("%s : minifyJS(%q) = %q, want %q", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"comments", "/* a */ p { color: red; }", "p{color: red}"},
+		{"selectors", "ul  li > a,\nh1 {\n  margin: 0 auto;\n}", "ul li>a,h1{margin: 0 auto}"},
+		{"pseudo classes", "a :hover { b: c }", "a :hover{b: c}"},
+		{"strings", `p:before { content: "a  /* b */ ; c"; }`, `p:before{content: "a  /* b */ ; c"}`},
+	}
+	for _, tt := range tests {
+		if got := string(minifyCSS([]byte(tt.src))); got != tt.want {
+			t.Errorf("%s : minifyCSS(%q) = %q, want %q", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+// jsKeywords are the keywords after which a slash starts a regular
+// expression, for jsTokens.
+var jsKeywords = []string{"return", "typeof", "instanceof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "yield", "await"}
+
+// jsTokens splits a script into its tokens, without the comments and the
+// spaces. A slash starts a regular expression unless it follows a value : a
+// name, a number, a string, a closing bracket or a regular expression.
+func jsTokens(src string) []string {
+	tokens := []string{}
+	afterValue := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		if isIdentChar(last[0]) {
+			return !stringInSlice(last, jsKeywords)
+		}
+		return strings.ContainsAny(last[:1], ")]}\"'`/")
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case strings.IndexByte(" \t\n\r\f\v", c) != -1:
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return tokens
+			}
+			i += end + 4
+		case isIdentChar(c):
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case c == '"' || c == '\'' || c == '`' || c == '/' && !afterValue():
+			j, class := i+1, false
+			for ; j < len(src); j++ {
+				if src[j] == '\\' {
+					j++
+					continue
+				}
+				if c == '/' && src[j] == '[' {
+					class = true
+				} else if c == '/' && src[j] == ']' {
+					class = false
+				} else if src[j] == c && !class {
+					break
+				}
+			}
+			if j < len(src) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		default:
+			tokens = append(tokens, src[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func TestMinifyBundledWidgets(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("assets", "widgets", "*", "*.js"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no widget scripts found : %v", err)
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, got := jsTokens(string(src)), jsTokens(string(minifyJS(src)))
+		if len(got) != len(want) {
+			t.Errorf("%s : %d tokens once minified, want %d", file, len(got), len(want))
+		}
+		for i := 0; i < len(got) && i < len(want); i++ {
+			if got[i] != want[i] {
+				t.Errorf("%s : token %d is %q once minified, want %q", file, i, got[i], want[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package dashing
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+// A cache keeps parsed templates and built bundles until one of the
+// dashboards, widgets or public folders changes. Its generation counts the
+// flushes, a value built before a flush being stale.
+type cache struct {
+	sync.RWMutex
+	items      map[string]interface{}
+	generation uint64
+}
+
+func newCache() *cache {
+	return &cache{
+		items: map[string]interface{}{},
+	}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	v, ok := c.items[key]
+	return v, ok
+}
+
+// current returns the generation of the cache.
+func (c *cache) current() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.generation
+}
+
+// set caches a value built during a generation, unless the cache was flushed
+// since.
+func (c *cache) set(key string, v interface{}, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.generation == generation {
+		c.items[key] = v
+	}
+}
+
+func (c *cache) flush() {
+	c.Lock()
+	defer c.Unlock()
+	c.items = map[string]interface{}{}
+	c.generation++
+}
+
+// fromCache returns the cached value of key, building and caching it when
+// missing. Nothing is cached in development mode.
+func (s *Server) fromCache(key string, build func() (interface{}, error)) (interface{}, error) {
+	if s.dev {
+		return build()
+	}
+	return s.cache.fetch(key, build)
+}
+
+// fetch returns the cached value of key, building and caching it when
+// missing, whatever the mode.
+func (c *cache) fetch(key string, build func() (interface{}, error)) (interface{}, error) {
+	generation := c.current()
+	if v, ok := c.get(key); ok {
+		return v, nil
+	}
+	v, err := build()
+	if err == nil {
+		c.set(key, v, generation)
+	}
+	return v, err
+}
+
+// A bundle is the concatenation of every widget file of a kind.
+type bundle struct {
+	content []byte
+	etag    string
+}
+
+func newBundle(content []byte) *bundle {
+	return &bundle{
+		content: content,
+		etag:    etagOf(content),
+	}
+}
+
+// etagOf returns a strong ETag of content.
+func etagOf(content []byte) string {
+	return fmt.Sprintf(`"%x"`, sha1.Sum(content))
+}
+
+// serve writes the bundle, answering the conditional and range requests.
+func (b *bundle) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", b.etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b.content))
+}
+
+// watch flushes the cache whenever a file of the dashboards, widgets, public,
+// partials, layouts, themes or conf folders, or of the folders of the other
+// asset layers, changes. In development mode, the
+// clients of the affected dashboards are also asked to reload, once the
+// changes settle.
+func (s *Server) watch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Server : can not watch files : %s", err)
+		return
+	}
+
+	for _, folder := range []string{"dashboards", "widgets", "public", "partials", "layouts", "themes", "conf"} {
+		watchFolders(watcher, s.webroot+folder)
+	}
+	for _, l := range s.assets().Layers[1:] {
+		for _, kind := range assetKinds {
+			if l.Path != "" && l.serves(kind) {
+				watchFolders(watcher, l.Path+kind)
+			}
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		reloads := map[string]bool{}
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case event := <-watcher.Events:
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if f, err := os.Stat(event.Name); err == nil && f.IsDir() {
+						watchFolders(watcher, event.Name)
+					}
+				}
+				s.cache.flush()
+				if s.dev {
+					if dashboard := s.reloadTarget(event.Name); dashboard != "" {
+						reloads[dashboard] = true
+						debounce = time.After(300 * time.Millisecond)
+					}
+				}
+			case <-debounce:
+				s.reload(reloads)
+				reloads = map[string]bool{}
+			case err := <-watcher.Errors:
+				log.Printf("Server : watch error : %s", err)
+			}
+		}
+	}()
+}
+
+// watchFolders adds a folder and all its sub folders to the watcher.
+func watchFolders(watcher *fsnotify.Watcher, root string) {
+	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil || !f.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Println(err)
+		}
+		return nil
+	})
+}
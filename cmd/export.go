@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vjeantet/goDashing"
+)
+
+const exportUsage = `usage :
+  goDashing export <dashboard> [<file>]
+
+the dashboard is exported by the goDashing server listening on $PORT, with
+the current data of its widgets, or rendered without data when no server is
+running. It is written to the file, or to the standard output.
+`
+
+// exportCommand writes a dashboard as a single HTML file, returning the exit
+// code.
+func exportCommand(webroot string, port string, args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprint(os.Stderr, exportUsage)
+		return 2
+	}
+	dashboard := strings.Trim(args[0], "/")
+
+	var content []byte
+	resp, err := http.Get("http://127.0.0.1:" + port + "/" + dashboard + "/export")
+	if err != nil {
+		log.Printf("no server listening on :%s, %s is exported without data", port, dashboard)
+		content, err = dashing.NewDashing(webroot, port, "").Server.ExportDashboard(dashboard)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "can not export %s : %s\n", dashboard, resp.Status)
+			return 1
+		}
+		content, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if len(args) == 1 {
+		os.Stdout.Write(content)
+		return 0
+	}
+	if err := ioutil.WriteFile(args[1], content, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vjeantet/goDashing"
+)
+
+const historyUsage = `usage :
+  goDashing history list <dashboard>
+  goDashing history show <dashboard> <version>
+  goDashing history diff <dashboard> <from> [<to>]
+  goDashing history restore <dashboard> <version>
+
+versions are given by their id, "current" being the current dashboard.
+`
+
+// historyCommand lists, shows, compares and restores the versions of a
+// dashboard, returning the exit code.
+func historyCommand(webroot string, args []string) int {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, historyUsage)
+		return 2
+	}
+
+	history := dashing.NewHistory(webroot)
+	dashboard := args[1]
+
+	switch {
+	case args[0] == "list":
+		versions, err := history.Versions(dashboard)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, v := range versions {
+			fmt.Printf("%s  %s  %-12s %s\n", v.ID, v.Time.Format("2006-01-02 15:04:05"), v.Author, v.Action)
+		}
+	case args[0] == "show" && len(args) == 3:
+		content, err := history.Content(dashboard, args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		os.Stdout.Write(content)
+	case args[0] == "diff" && (len(args) == 3 || len(args) == 4):
+		to := "current"
+		if len(args) == 4 {
+			to = args[3]
+		}
+		diff, err := history.Diff(dashboard, args[2], to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Print(diff)
+	case args[0] == "restore" && len(args) == 3:
+		author := os.Getenv("USER")
+		if author == "" {
+			author = "cli"
+		}
+		v, err := history.Restore(dashboard, args[2], author)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s restored as %s\n", args[2], v.ID)
+	default:
+		fmt.Fprint(os.Stderr, historyUsage)
+		return 2
+	}
+	return 0
+}
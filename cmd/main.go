@@ -6,41 +6,74 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/vjeantet/goDashing"
 	_ "github.com/vjeantet/goDashing/jobs"
 )
 
-func tokenAuthMiddleware(h http.Handler) http.Handler {
-	auth := []byte(os.Getenv("TOKEN"))
+// maxTokenBody is the size of the largest body read for its auth_token field.
+const maxTokenBody = 1 << 20
 
+// tokenBody tells whether the body of a request may hold an auth_token field :
+// any POST body, json whatever its Content-Type, and the json body of the
+// other methods. Multipart forms and uploads are never read.
+func tokenBody(r *http.Request) bool {
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediatype, "multipart/") || strings.HasSuffix(r.URL.Path, "/public/uploads") {
+		return false
+	}
+	return r.Method == "POST" || mediatype == "application/json"
+}
+
+// tokenAuthMiddleware checks the api token of the requests changing
+// something, tokens mapping each token name to its value.
+func tokenAuthMiddleware(h http.Handler, tokens map[string]string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if len(auth) == 0 {
+		if len(tokens) == 0 {
 			h.ServeHTTP(w, r)
 			return
 		}
-		if r.Method == "POST" {
-			body, _ := ioutil.ReadAll(r.Body)
-			r.Body.Close()
-			r.Body = ioutil.NopCloser(bytes.NewReader(body))
-
-			var data map[string]interface{}
-			json.Unmarshal(body, &data)
-			token, ok := data["auth_token"]
-			if !ok {
+		if r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" {
+			// The token is given by the X-Auth-Token header, or by the
+			// auth_token field of a json body
+			token := r.Header.Get("X-Auth-Token")
+			if token == "" && tokenBody(r) {
+				body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxTokenBody))
+				r.Body.Close()
+				if err != nil {
+					log.Printf("Auth token missing: %s", err)
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+				var data map[string]interface{}
+				json.Unmarshal(body, &data)
+				token, _ = data["auth_token"].(string)
+			}
+			if token == "" {
 				log.Printf("Auth token missing")
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			}
 
-			if result := subtle.ConstantTimeCompare(auth, []byte(token.(string))); result != 1 {
-				log.Printf("Invalid auth token: expected %s, got %s", auth, token)
+			name := ""
+			for n, auth := range tokens {
+				if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) == 1 {
+					name = n
+				}
+			}
+			if name == "" {
+				log.Printf("Invalid auth token from %s", r.RemoteAddr)
 				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 				return
 			}
+			r = dashing.WithAuthor(r, name)
 		}
 
 		h.ServeHTTP(w, r)
@@ -61,11 +94,71 @@ func main() {
 		webroot = webroot + string(filepath.Separator)
 	}
 
-	dash := dashing.NewDashing(webroot, port, os.Getenv("TOKEN")).Start()
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(historyCommand(webroot, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(exportCommand(webroot, port, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "widget" {
+		os.Exit(widgetCommand(webroot, os.Args[2:]))
+	}
+
+	tokens, err := dashing.ReadTokens(webroot)
+	if err != nil {
+		log.Fatalf("can not read conf/tokens.toml : %s", err)
+	}
+	if os.Getenv("TOKEN") != "" {
+		tokens["default"] = os.Getenv("TOKEN")
+	}
+	overlay, err := dashing.NewAssetOverlay(webroot)
+	if err != nil {
+		log.Fatalf("can not read conf/assets.toml : %s", err)
+	}
+	policy, err := dashing.ReadCachePolicy(webroot)
+	if err != nil {
+		log.Fatalf("can not read conf/static.toml : %s", err)
+	}
+
+	dash := dashing.NewDashing(webroot, port, os.Getenv("TOKEN"))
+	dash.Server.SetAssets(overlay, policy)
+	var handler http.Handler = tokenAuthMiddleware(dash.Start(), tokens)
+
+	// Each tenant has its own webroot, tokens and broker, the requests of
+	// no tenant being served by the webroot
+	tenants, err := dashing.ReadTenants(webroot)
+	if err != nil {
+		log.Fatalf("can not read conf/tenants.toml : %s", err)
+	}
+	if len(tenants) > 0 {
+		router := dashing.NewTenantRouter(handler)
+		for _, t := range tenants {
+			tenantTokens, err := dashing.ReadTokens(t.Webroot)
+			if err != nil {
+				log.Fatalf("tenant %s : can not read conf/tokens.toml : %s", t.Name, err)
+			}
+			if t.Token != "" {
+				tenantTokens["default"] = t.Token
+			}
+			overlay, err := dashing.NewAssetOverlay(t.Webroot)
+			if err != nil {
+				log.Fatalf("tenant %s : can not read conf/assets.toml : %s", t.Name, err)
+			}
+			policy, err := dashing.ReadCachePolicy(t.Webroot)
+			if err != nil {
+				log.Fatalf("tenant %s : can not read conf/static.toml : %s", t.Name, err)
+			}
+			tenant := dashing.NewTenant(t, port)
+			tenant.Server.SetAssets(overlay, policy)
+			router.Add(t, tokenAuthMiddleware(tenant.Start(), tenantTokens))
+			log.Printf("tenant %s : %s", t.Name, t.Webroot)
+		}
+		handler = router
+	}
 	log.Println("listening on :" + port)
 
 	// open.Run("http://127.0.0.1:" + port + "/")
 
-	log.Fatal(http.ListenAndServe(":"+port, tokenAuthMiddleware(dash)))
+	log.Fatal(http.ListenAndServe(":"+port, handler))
 
 }
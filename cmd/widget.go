@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vjeantet/goDashing"
+)
+
+const widgetUsage = `usage :
+  goDashing widget install [-f] <archive|dir>
+  goDashing widget list
+  goDashing widget remove <name>
+
+a widget package is a folder, or a .zip, .tar.gz or .tgz archive of it, with
+a widget.toml manifest and the NAME.html, NAME.js and NAME.css files of the
+widget. -f replaces an installed widget, or overrides an embedded one or one
+of another asset layer, with the same name.
+`
+
+// widgetCommand installs, lists and removes the widgets of the webroot,
+// returning the exit code.
+func widgetCommand(webroot string, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, widgetUsage)
+		return 2
+	}
+
+	switch {
+	case args[0] == "install" && (len(args) == 2 || len(args) == 3 && args[1] == "-f"):
+		m, err := dashing.InstallWidget(webroot, args[len(args)-1], len(args) == 3)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s %s installed into widgets/%s\n", m.Name, m.Version, m.Name)
+	case args[0] == "list" && len(args) == 1:
+		for _, w := range dashing.ListWidgets(webroot) {
+			version, description := "-", ""
+			if w.Manifest != nil {
+				version, description = w.Manifest.Version, w.Manifest.Description
+			}
+			fmt.Printf("%-20s %-10s %-20s %s\n", w.Name, version, strings.Join(w.Layers, ","), description)
+		}
+	case args[0] == "remove" && len(args) == 2:
+		if err := dashing.RemoveWidget(webroot, args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s removed\n", args[1])
+	default:
+		fmt.Fprint(os.Stderr, widgetUsage)
+		return 2
+	}
+	return 0
+}
@@ -5,17 +5,23 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/GeertJohan/go.rice"
 )
 
 // An Event contains the widget ID, a body of data,
-// and an optional target (only "dashboard" for now).
+// an optional target (only "dashboard" for now), an optional
+// screen name restricting delivery to the clients of that screen and an
+// optional namespace restricting it to the dashboards of that namespace.
 type Event struct {
-	ID     string
-	Body   map[string]interface{}
-	Target string
+	ID        string
+	Body      map[string]interface{}
+	Target    string
+	Screen    string
+	Namespace string
 }
 
 func NewEvent(id string, data map[string]interface{}, target string) *Event {
@@ -55,6 +61,7 @@ func (d *Dashing) Start() *Dashing {
 		}
 		d.Broker.Start()
 		d.Worker.Start()
+		d.Server.watch()
 		d.started = true
 	}
 	return d
@@ -94,6 +101,31 @@ func exists(path string) (bool, error) {
 	return true, err
 }
 
+// servers are the servers of the webroots, sharing their caches with the
+// jobs.
+var servers = struct {
+	sync.RWMutex
+	m map[string]*Server
+}{m: map[string]*Server{}}
+
+// runningServer returns the server of a webroot.
+func runningServer(webroot string) (*Server, bool) {
+	servers.RLock()
+	defer servers.RUnlock()
+	s, ok := servers.m[webroot]
+	return s, ok
+}
+
+// serverOf returns the server of a webroot, or a new one when it has none.
+func serverOf(webroot string) *Server {
+	if s, ok := runningServer(webroot); ok {
+		return s
+	}
+	s := NewServer(nil)
+	s.webroot = webroot
+	return s
+}
+
 // NewDashing sets up the event broker, workers and webservice.
 func NewDashing(root string, port string, token string) *Dashing {
 	broker := NewBroker()
@@ -101,15 +133,22 @@ func NewDashing(root string, port string, token string) *Dashing {
 	server := NewServer(broker)
 
 	server.webroot = root
+	server.history = NewHistory(root)
 	worker.webroot = root
 	worker.url = "http://127.0.0.1:" + port
 	worker.token = token
 
-	if os.Getenv("DEV") != "" {
-		server.dev = true
+	// Development mode is on, unless DEV turns it off so that templates
+	// and bundles are cached
+	server.dev = true
+	if dev, err := strconv.ParseBool(os.Getenv("DEV")); err == nil {
+		server.dev = dev
 	}
 
-	server.dev = true
+	servers.Lock()
+	servers.m[root] = server
+	servers.Unlock()
+
 	return &Dashing{
 		started: false,
 		Broker:  broker,
@@ -0,0 +1,158 @@
+package dashing
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A templateError is returned when a template can not be found, parsed or
+// rendered. Its file is relative to the webroot.
+type templateError struct {
+	status int
+	file   string
+	err    error
+	// source is the content of the file, when it could be read
+	source string
+	// lookups are the locations tried, when the file could not be found
+	lookups []string
+}
+
+func (e *templateError) Error() string {
+	return fmt.Sprintf("%s : %s", e.file, e.err.Error())
+}
+
+// A templateFile is a file of a template chain, relative to the webroot.
+type templateFile struct {
+	name    string
+	content string
+}
+
+var (
+	htmlTemplatePosRegex = regexp.MustCompile(`template:\s?([^:]+):(\d+)(?::(\d+))?:`)
+	gerbSnippetRegex     = regexp.MustCompile(`: (<%(?s:.*))$`)
+)
+
+// newTemplateError returns the error of a chain of template files, blaming
+// the file named by the error, or the one holding the tag it quotes, else
+// the first file.
+func newTemplateError(status int, err error, files ...templateFile) *templateError {
+	blamed := files[0]
+	if m := htmlTemplatePosRegex.FindStringSubmatch(err.Error()); m != nil {
+		for _, f := range files {
+			if f.name == m[1] {
+				blamed = f
+			}
+		}
+	} else if m := gerbSnippetRegex.FindStringSubmatch(err.Error()); m != nil {
+		for _, f := range files {
+			if strings.Contains(f.content, m[1]) {
+				blamed = f
+				break
+			}
+		}
+	}
+	return &templateError{status: status, file: blamed.name, err: err, source: blamed.content}
+}
+
+// position returns the line and column of the error in its source, 0 when
+// unknown.
+func (e *templateError) position() (int, int) {
+	if m := htmlTemplatePosRegex.FindStringSubmatch(e.err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		return line, col
+	}
+	if m := gerbSnippetRegex.FindStringSubmatch(e.err.Error()); m != nil {
+		if i := strings.Index(e.source, m[1]); i != -1 {
+			return strings.Count(e.source[:i], "\n") + 1, i - strings.LastIndex(e.source[:i], "\n")
+		}
+	}
+	return 0, 0
+}
+
+// lookups returns the locations tried by fileGetContent for a file of a box.
+func (s *Server) lookups(path string, boxName string) []string {
+	return s.assets().lookups(boxName, path)
+}
+
+// An excerptLine is a line of the source excerpt of an error page.
+type excerptLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// excerpt returns the lines of a source around a line.
+func excerpt(source string, line int) []excerptLine {
+	const context = 5
+	if line == 0 {
+		return nil
+	}
+	lines := []excerptLine{}
+	for i, text := range strings.Split(source, "\n") {
+		if n := i + 1; n >= line-context && n <= line+context {
+			lines = append(lines, excerptLine{n, text, n == line})
+		}
+	}
+	return lines
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>{{.Status}} - {{.File}}</title>
+  <style>
+    body { margin: 30px; background: #222; color: #eee; font-family: sans-serif; }
+    h1 { color: #e84c3d; font-size: 24px; }
+    pre { background: #111; padding: 10px; overflow: auto; }
+    .current { background: #5b1e17; display: block; }
+    .number { color: #888; }
+  </style>
+</head>
+<body>
+  <h1>{{.Status}} {{.StatusText}}</h1>
+  <p><strong>{{.File}}{{if .Line}}:{{.Line}}{{if .Column}}:{{.Column}}{{end}}{{end}}</strong></p>
+  <pre>{{.Message}}</pre>
+  {{if .Excerpt}}
+  <h2>Source</h2>
+  <pre>{{range .Excerpt}}<span{{if .Current}} class="current"{{end}}><span class="number">{{printf "%4d" .Number}}</span>  {{.Text}}</span>
+{{end}}</pre>
+  {{end}}
+  {{if .Lookups}}
+  <h2>Lookups</h2>
+  <ul>{{range .Lookups}}<li>{{.}}</li>{{end}}</ul>
+  {{end}}
+</body>
+</html>
+`))
+
+// serveTemplateError answers a request failing on a template : with an error
+// page telling where and why in development mode, with its status only in
+// production.
+func (s *Server) serveTemplateError(w http.ResponseWriter, r *http.Request, e *templateError) {
+	log.Printf("%d - %s - %s\n", e.status, r.URL.Path, e.Error())
+	if !s.dev {
+		http.Error(w, "", e.status)
+		return
+	}
+
+	line, col := e.position()
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(e.status)
+	errorPageTemplate.Execute(w, map[string]interface{}{
+		"Status":     e.status,
+		"StatusText": http.StatusText(e.status),
+		"File":       e.file,
+		"Line":       line,
+		"Column":     col,
+		"Message":    e.err.Error(),
+		"Excerpt":    excerpt(e.source, line),
+		"Lookups":    e.lookups,
+	})
+}
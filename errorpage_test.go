@@ -0,0 +1,104 @@
+package dashing
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateErrorPosition(t *testing.T) {
+	dashboard := templateFile{"dashboards/a.gerb", "<div>\n  <%= if %>\n</div>"}
+	layout := templateFile{"dashboards/layout.gerb", "<html>\n<%! yield %>\n<% end %>\n</html>"}
+
+	tests := []struct {
+		name   string
+		err    error
+		file   string
+		line   int
+		column int
+	}{
+		{"gerb tag of the dashboard", fmt.Errorf("unexpected if : <%%= if %%>\n</div>"), "dashboards/a.gerb", 2, 3},
+		{"gerb tag of the layout", fmt.Errorf("unexpected end : <%% end %%>\n</html>"), "dashboards/layout.gerb", 3, 1},
+		{"html/template position", fmt.Errorf("template: dashboards/layout.gerb:4:7: unexpected EOF"), "dashboards/layout.gerb", 4, 7},
+		{"html/template line", fmt.Errorf("template: dashboards/a.gerb:2: function \"x\" not defined"), "dashboards/a.gerb", 2, 0},
+		{"unknown", fmt.Errorf("something failed"), "dashboards/a.gerb", 0, 0},
+	}
+	for _, tt := range tests {
+		e := newTemplateError(500, tt.err, dashboard, layout)
+		line, column := e.position()
+		if e.file != tt.file || line != tt.line || column != tt.column {
+			t.Errorf("%s : %s:%d:%d, want %s:%d:%d", tt.name, e.file, line, column, tt.file, tt.line, tt.column)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	source := strings.Repeat("line\n", 20)
+	lines := excerpt(source, 3)
+	numbers := []int{}
+	for _, l := range lines {
+		numbers = append(numbers, l.Number)
+		if l.Current != (l.Number == 3) {
+			t.Errorf("line %d current %v", l.Number, l.Current)
+		}
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("excerpt of line 3 : lines %v, want %v", numbers, want)
+	}
+	if lines := excerpt(source, 0); lines != nil {
+		t.Errorf("excerpt of an unknown line : %v, want none", lines)
+	}
+}
+
+func TestTemplateErrorPages(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/layout.gerb":     `<html><%! yield %></html>`,
+		"dashboards/broken.gerb":     "<div>\n<% if %>\n</div>",
+		"dashboards/tv/folder.toml":  "layout = \"tv\"\n",
+		"dashboards/tv/lobby.gerb":   `<div></div>`,
+		"widgets/Broken/Broken.html": "<div>\n<% if %></div>",
+		"dashboards/escaped.gerb":    "<% if %><script>",
+	})
+	defer cleanup()
+	router := s.NewRouter()
+
+	tests := []struct {
+		url    string
+		status int
+		dev    []string
+	}{
+		{"/broken", 500, []string{"dashboards/broken.gerb:2:1", `<span class="current"><span class="number">   2</span>  &lt;% if %&gt;</span>`}},
+		{"/tv/lobby", 500, []string{"layouts/tv.gerb", "<h2>Lookups</h2>", "layouts/tv.gerb</li>"}},
+		{"/views/Broken.html", 500, []string{"widgets/Broken/Broken.html:2:1"}},
+		{"/views/missing.html", 404, []string{"widgets/missing/missing.html", "widget not found", "missing/missing.html</li>", "Missing/Missing.html</li>"}},
+		{"/escaped", 500, []string{"&lt;script&gt;"}},
+	}
+	for _, dev := range []bool{false, true} {
+		s.dev = dev
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.status {
+				t.Errorf("%s in development mode %v : status %d, want %d", tt.url, dev, w.Code, tt.status)
+				continue
+			}
+			body := w.Body.String()
+			if !dev {
+				if strings.TrimSpace(body) != "" {
+					t.Errorf("%s in production : %q, want an empty body", tt.url, body)
+				}
+				continue
+			}
+			for _, want := range tt.dev {
+				if !strings.Contains(body, want) {
+					t.Errorf("%s in development : %q, want %q", tt.url, body, want)
+				}
+			}
+			if strings.Contains(body, "<script>") {
+				t.Errorf("%s in development : the source is not escaped", tt.url)
+			}
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package dashing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	scriptSrcRegex   = regexp.MustCompile(`(?i)<script[^>]*\ssrc\s*=\s*["']([^"']+)["'][^>]*>\s*</script>`)
+	stylesheetRegex  = regexp.MustCompile(`(?i)<link[^>]*\brel\s*=\s*["']?stylesheet["']?[^>]*>`)
+	hrefRegex        = regexp.MustCompile(`(?i)\shref\s*=\s*["']([^"']+)["']`)
+	imgSrcRegex      = regexp.MustCompile(`(?i)(<img[^>]*\ssrc\s*=\s*["'])([^"']+)(["'])`)
+	cssURLRegex      = regexp.MustCompile(`url\(\s*["']?([^"')]+)["']?\s*\)`)
+	widgetViewRegex  = regexp.MustCompile(`data-view\s*=\s*["']([^"']+)["']`)
+	underscoreRegex1 = regexp.MustCompile(`([A-Z]+)([A-Z][a-z])`)
+	underscoreRegex2 = regexp.MustCompile(`([a-z\d])([A-Z])`)
+)
+
+// underscore returns the name of the view of a widget type, as the client
+// asks for it : "BarChart" is "bar_chart".
+func underscore(view string) string {
+	view = underscoreRegex1.ReplaceAllString(view, "${1}_${2}")
+	view = underscoreRegex2.ReplaceAllString(view, "${1}_${2}")
+	return strings.ToLower(strings.Replace(view, "-", "_", 1))
+}
+
+// exportEventSource replaces the EventSource of an exported dashboard, to
+// replay the frozen events instead of connecting to the server.
+const exportEventSource = `<script type="text/javascript">
+(function() {
+  var events = %s;
+  window.EventSource = function() {
+    var self = this;
+    this.listeners = {};
+    setTimeout(function() {
+      var i, j, listeners = self.listeners.message || [];
+      for (i = 0; i < events.length; i++) {
+        for (j = 0; j < listeners.length; j++) {
+          listeners[j]({data: JSON.stringify(events[i])});
+        }
+      }
+    }, 0);
+  };
+  window.EventSource.CLOSED = 2;
+  window.EventSource.prototype.addEventListener = function(type, listener) {
+    (this.listeners[type] = this.listeners[type] || []).push(listener);
+  };
+})();
+</script>
+`
+
+// exportViews gives the views of the widgets of an exported dashboard,
+// instead of fetching them from the server.
+const exportViews = `<script type="text/javascript">
+(function() {
+  var views = %s;
+  Batman.ViewStore.prototype.fetchView = function(path) {
+    var self = this, key = path.replace(/^\//, '').replace(/[_-]/g, '').toLowerCase();
+    setTimeout(function() {
+      self.set(path, views[key] || '');
+    }, 0);
+  };
+})();
+</script>
+`
+
+// ExportHandler serves a dashboard as a single HTML file, rendering offline
+// with the current data of its widgets, at /DASHBOARD/export or at its
+// /_export/DASHBOARD alias.
+func (s *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	dashboardpath := strings.Trim(r.URL.Path, "/")
+	if strings.HasPrefix(dashboardpath, "_export/") {
+		dashboardpath = strings.Trim(strings.TrimPrefix(dashboardpath, "_export/"), "/")
+	} else {
+		dashboardpath = strings.TrimSuffix(dashboardpath, "/export")
+	}
+
+	file, values := s.resolveDashboard(dashboardpath)
+	v, err := s.fromCache("dashboard:"+file, func() (interface{}, error) {
+		return s.parseDashboard(file)
+	})
+	if err != nil {
+		s.serveTemplateError(w, r, err.(*templateError))
+		return
+	}
+	tpl := v.(*dashboardTemplate)
+
+	params, err := tpl.meta.paramValues(values, r.URL.Query())
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "dashboards", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+
+	// Rendered without the rotation and the development tools
+	var page bytes.Buffer
+	err = tpl.template.render(&page, s.withHelpers(paramsContext(map[string]interface{}{
+		"dashboard":   path.Base(dashboardpath),
+		"template":    file,
+		"prefix":      s.prefix,
+		"development": false,
+		"request":     r,
+		"next":        false,
+		"nextname":    "",
+		"refresh":     defaultDuration,
+		"meta":        tpl.meta,
+		// The layouts give it to the switcher, the server rotating the
+		// dashboards
+		"dashboardnames": "",
+		"theme":          s.getTheme(w, r, dashboardpath, tpl.meta),
+		"events":         s.eventsURL(dashboardpath),
+		"widgetsjs":      s.prefix + "/widgets.js",
+		"widgetscss":     s.prefix + "/widgets.css",
+	}, params)))
+	if err != nil {
+		s.serveTemplateError(w, r, newTemplateError(http.StatusInternalServerError, err, tpl.files...))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, path.Base(dashboardpath)))
+	w.Write(s.exportPage(page.Bytes(), s.getNamespace(dashboardpath)))
+}
+
+// exportPage inlines the scripts, stylesheets, fonts and images of a
+// rendered dashboard, along with the views of its widgets and the cached
+// events of their IDs in the namespace of the dashboard.
+func (s *Server) exportPage(page []byte, namespace string) []byte {
+	views, ids := []string{}, []string{}
+	for _, m := range widgetViewRegex.FindAllSubmatch(page, -1) {
+		if !stringInSlice(string(m[1]), views) {
+			views = append(views, string(m[1]))
+		}
+	}
+	for _, m := range widgetIDRegex.FindAllSubmatch(page, -1) {
+		if !stringInSlice(string(m[1]), ids) {
+			ids = append(ids, string(m[1]))
+		}
+	}
+
+	page = scriptSrcRegex.ReplaceAllFunc(page, func(tag []byte) []byte {
+		src := string(scriptSrcRegex.FindSubmatch(tag)[1])
+		content, _, err := s.exportAsset(src, views)
+		if err != nil {
+			log.Printf("Export : can not inline %s : %s", src, err)
+			return tag
+		}
+		content = bytes.Replace(content, []byte("</script"), []byte(`<\/script`), -1)
+		return []byte(`<script type="text/javascript">` + "\n" + string(content) + "\n</script>")
+	})
+
+	page = stylesheetRegex.ReplaceAllFunc(page, func(tag []byte) []byte {
+		m := hrefRegex.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		href := string(m[1])
+		content, _, err := s.exportAsset(href, views)
+		if err != nil {
+			log.Printf("Export : can not inline %s : %s", href, err)
+			return tag
+		}
+		return []byte("<style>\n" + string(s.inlineCSSURLs(href, content)) + "\n</style>")
+	})
+
+	page = imgSrcRegex.ReplaceAllFunc(page, func(tag []byte) []byte {
+		m := imgSrcRegex.FindSubmatch(tag)
+		uri, ok := s.dataURI(string(m[2]))
+		if !ok {
+			return tag
+		}
+		return []byte(string(m[1]) + uri + string(m[3]))
+	})
+
+	events, _ := json.Marshal(s.exportEvents(namespace, ids))
+	widgetViews, _ := json.Marshal(s.exportWidgetViews(views))
+
+	page = insertAfter(page, "<head>", fmt.Sprintf(exportEventSource, events))
+	page = insertBefore(page, "</body>", fmt.Sprintf(exportViews, widgetViews))
+	return page
+}
+
+// exportAsset returns the content and the type of an asset of a dashboard,
+// the widgets bundles holding only the widgets of the dashboard.
+func (s *Server) exportAsset(url string, views []string) ([]byte, string, error) {
+	if i := strings.IndexAny(url, "?#"); i != -1 {
+		url = url[:i]
+	}
+	if s.prefix != "" {
+		url = strings.TrimPrefix(url, s.prefix)
+	}
+
+	switch {
+	case url == "/widgets.js" || url == "/widgets.css":
+		return s.buildWidgetsBundleOf(views, path.Ext(url)), mimeType(url), nil
+	case strings.HasPrefix(url, "/themes/") && strings.HasSuffix(url, ".css"):
+		content, err := s.buildTheme(strings.TrimSuffix(strings.TrimPrefix(url, "/themes/"), ".css"))
+		return content, mimeType(url), err
+	case strings.HasPrefix(url, "/public/"):
+		name := strings.TrimPrefix(path.Clean(url), "/public/")
+		content, _, err := s.fileGetContent(name, "public")
+		return []byte(content), mimeType(url), err
+	}
+	return nil, "", fmt.Errorf("not an asset of the dashboard")
+}
+
+// inlineCSSURLs turns the urls of a stylesheet, fonts and images, into data
+// URIs.
+func (s *Server) inlineCSSURLs(href string, content []byte) []byte {
+	return cssURLRegex.ReplaceAllFunc(content, func(m []byte) []byte {
+		url := string(cssURLRegex.FindSubmatch(m)[1])
+		if strings.HasPrefix(url, "data:") {
+			return m
+		}
+		if !strings.HasPrefix(url, "/") && !strings.Contains(url, "://") {
+			url = path.Join(path.Dir(href), url)
+		}
+		uri, ok := s.dataURI(url)
+		if !ok {
+			return m
+		}
+		return []byte("url(" + uri + ")")
+	})
+}
+
+// dataURI returns an asset as a data URI.
+func (s *Server) dataURI(url string) (string, bool) {
+	content, mimetype, err := s.exportAsset(url, nil)
+	if err != nil {
+		return "", false
+	}
+	return "data:" + mimetype + ";base64," + base64.StdEncoding.EncodeToString(content), true
+}
+
+// buildWidgetsBundleOf concatenates the files of a kind of the given widget
+// types, after the dependencies of their manifests.
+func (s *Server) buildWidgetsBundleOf(views []string, ext string) []byte {
+	var content bytes.Buffer
+	content.Write(s.widgetDependencies(views, ext))
+	for _, view := range views {
+		for _, name := range []string{view, underscore(view), strings.ToLower(view), CamelCase(view)} {
+			// The files of a layer shadow the ones of the next layers
+			found := false
+			for _, l := range s.assets().Layers {
+				for _, file := range l.files("widgets", name) {
+					if path.Ext(file) != ext {
+						continue
+					}
+					if c, err := l.readFile("widgets", file); err == nil {
+						content.Write(c)
+						content.WriteString("\n\n\n")
+						found = true
+					}
+				}
+				if found {
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+	}
+	return content.Bytes()
+}
+
+// exportEvents returns the bodies of the cached events of the given widget
+// IDs of a namespace.
+func (s *Server) exportEvents(namespace string, ids []string) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	if s.broker == nil {
+		return events
+	}
+	for _, id := range ids {
+		if e, ok := s.broker.cached(namespace, id); ok {
+			events = append(events, e.Body)
+		}
+	}
+	return events
+}
+
+// exportWidgetViews renders the view of each widget type, keyed by its name
+// in lower case without dashes and underscores, as the client looks it up.
+func (s *Server) exportWidgetViews(views []string) map[string]string {
+	rendered := map[string]string{}
+	for _, view := range views {
+		tpl, err := s.parseWidget(underscore(view))
+		if err != nil {
+			log.Printf("Export : %s", err)
+			continue
+		}
+		var out bytes.Buffer
+		tpl.template.Render(&out, nil)
+		key := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(view))
+		rendered[key] = out.String()
+	}
+	return rendered
+}
+
+func insertAfter(page []byte, tag string, content string) []byte {
+	i := bytes.Index(bytes.ToLower(page), []byte(tag))
+	if i == -1 {
+		return append([]byte(content), page...)
+	}
+	i += len(tag)
+	return append(page[:i:i], append([]byte("\n"+content), page[i:]...)...)
+}
+
+func insertBefore(page []byte, tag string, content string) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte(tag))
+	if i == -1 {
+		return append(page, content...)
+	}
+	return append(page[:i:i], append([]byte(content), page[i:]...)...)
+}
+
+// ExportDashboard exports a dashboard, as ExportHandler does, with the data
+// received by the server.
+func (s *Server) ExportDashboard(dashboardpath string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	s.ExportHandler(w, httptest.NewRequest("GET", "/"+dashboardpath+"/export", nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("can not export %s : %d %s", dashboardpath, w.Code, http.StatusText(w.Code))
+	}
+	return w.Body.Bytes(), nil
+}
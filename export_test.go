@@ -0,0 +1,40 @@
+package dashing
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportRoutes(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/sales.gerb":          `<% content "title" { %>Sales<% } %><div data-id="a" data-view="Number"></div>`,
+		"dashboards/reports/export.gerb": `<% content "title" { %>Reports<% } %><div data-id="b" data-view="Number"></div>`,
+	})
+	defer cleanup()
+	router := s.NewRouter()
+
+	tests := []struct {
+		url    string
+		status int
+		export bool
+	}{
+		{"/sales/export", 200, true},
+		{"/_export/sales", 200, true},
+		{"/reports/export", 200, false},
+		{"/_export/reports/export", 200, true},
+		{"/missing/export", 404, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.url, w.Code, tt.status)
+			continue
+		}
+		// An export inlines the views of its widgets
+		if export := strings.Contains(w.Body.String(), "Batman.ViewStore.prototype.fetchView"); tt.status == 200 && export != tt.export {
+			t.Errorf("%s : exported %v, want %v", tt.url, export, tt.export)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package dashing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A widgetPosition is the position and size of a widget in the gridster
+// layout of a dashboard.
+type widgetPosition struct {
+	ID    string `json:"id"`
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	SizeX int    `json:"sizex"`
+	SizeY int    `json:"sizey"`
+}
+
+// valid tells whether a position is within the grid, its row, column and
+// size starting at 1.
+func (p widgetPosition) valid() bool {
+	return p.Row >= 1 && p.Col >= 1 && p.SizeX >= 1 && p.SizeY >= 1
+}
+
+// liRegex matches the opening <li> tags, with the template actions and the
+// quoted values of their attributes, which may hold a ">".
+var liRegex = regexp.MustCompile(`(?i)<li\b(?:<%.*?%>|\{\{.*?\}\}|"[^"]*"|'[^']*'|[^>])*>`)
+
+// setGridsterLayout rewrites the data-row, data-col, data-sizex and
+// data-sizey attributes of the <li> holding each widget. Widgets sharing an
+// ID are matched in the order of the document. The <li> tags written by a
+// template action, and the positions out of the grid, are left as they are.
+func setGridsterLayout(content string, positions []widgetPosition) string {
+	byID := map[string][]widgetPosition{}
+	for _, p := range positions {
+		if p.valid() {
+			byID[p.ID] = append(byID[p.ID], p)
+		}
+	}
+
+	var result bytes.Buffer
+	last := 0
+	tags := liRegex.FindAllStringIndex(content, -1)
+	for i, t := range tags {
+		// The <li> holds everything up to its closing tag, or the next <li>
+		end := len(content)
+		if i+1 < len(tags) {
+			end = tags[i+1][0]
+		}
+		if closing := strings.Index(strings.ToLower(content[t[1]:end]), "</li>"); closing != -1 {
+			end = t[1] + closing
+		}
+
+		id := widgetIDRegex.FindStringSubmatch(content[t[1]:end])
+		if id == nil || len(byID[id[1]]) == 0 {
+			continue
+		}
+		p := byID[id[1]][0]
+		byID[id[1]] = byID[id[1]][1:]
+
+		tag := content[t[0] : t[1]-1]
+		if strings.Contains(tag, "<%") || strings.Contains(tag, "{{") {
+			continue
+		}
+		tag = setAttribute(tag, "data-row", p.Row)
+		tag = setAttribute(tag, "data-col", p.Col)
+		tag = setAttribute(tag, "data-sizex", p.SizeX)
+		tag = setAttribute(tag, "data-sizey", p.SizeY)
+
+		result.WriteString(content[last:t[0]])
+		result.WriteString(tag)
+		last = t[1] - 1
+	}
+	result.WriteString(content[last:])
+
+	return result.String()
+}
+
+// setAttribute sets the value of an attribute of an opening tag, given
+// without its closing ">".
+func setAttribute(tag string, name string, value int) string {
+	re := regexp.MustCompile(`(\s` + name + `\s*=\s*)("[^"]*"|'[^']*'|[^\s>]*)`)
+	if re.MatchString(tag) {
+		return re.ReplaceAllString(tag, fmt.Sprintf(`${1}"%d"`, value))
+	}
+	return fmt.Sprintf(`%s %s="%d"`, tag, name, value)
+}
+
+// LayoutHandler saves the gridster layout of a dashboard into its .gerb or
+// .tmpl file, keeping a .bak copy of the previous version, and answers the
+// file saved.
+func (s *Server) LayoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	var data struct {
+		Widgets []widgetPosition `json:"widgets"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	for _, p := range data.Widgets {
+		if !p.valid() {
+			http.Error(w, fmt.Sprintf("invalid position of %s", p.ID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dashboardpath := param(r, "_name")
+	if !validDashboardPath(dashboardpath) {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	// The layout of a parameterised dashboard is saved into its template,
+	// where widget IDs are not expanded yet
+	dashboardpath, values := s.resolveDashboard(dashboardpath)
+	ext := s.dashboardExt(dashboardpath)
+	// The layout is written into the webroot, shadowing the dashboard of the
+	// next asset layers
+	file := s.webroot + "dashboards/" + dashboardpath + ext
+	content, _, err := s.assets().ReadFile("dashboards", dashboardpath+ext)
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "dashboards", dashboardpath+ext)
+		http.NotFound(w, r)
+		return
+	}
+	if values != nil {
+		data.Widgets = s.unexpandIDs(string(content), ext, values, data.Widgets)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if err := ioutil.WriteFile(file+".bak", content, 0644); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	layout := []byte(setGridsterLayout(string(content), data.Widgets))
+	if err := ioutil.WriteFile(file, layout, 0644); err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	s.snapshot(r, dashboardpath, content, layout, "layout")
+
+	writeJSON(w, http.StatusOK, map[string]string{"file": "dashboards/" + dashboardpath + ext})
+}
+
+// unexpandIDs gives back to the positions of the widgets of a parameterised
+// dashboard the IDs they have in its template.
+func (s *Server) unexpandIDs(content string, ext string, values []string, positions []widgetPosition) []widgetPosition {
+	meta, _, err := parseFrontMatter(content)
+	if err != nil {
+		return positions
+	}
+	params, err := meta.paramValues(values, nil)
+	if err != nil {
+		return positions
+	}
+
+	ids := map[string]string{}
+	for _, m := range widgetIDRegex.FindAllStringSubmatch(content, -1) {
+		if id, err := s.expandDashboard(m[1], ext, params); err == nil {
+			ids[id] = m[1]
+		}
+	}
+	for i, p := range positions {
+		if id, ok := ids[p.ID]; ok {
+			positions[i].ID = id
+		}
+	}
+	return positions
+}
+
+// validDashboardPath tells whether a dashboard path stays within the
+// dashboards folder, out of its hidden files.
+func validDashboardPath(dashboardpath string) bool {
+	if dashboardpath == "" || strings.Contains(dashboardpath, "\\") || strings.HasPrefix(dashboardpath, "/") {
+		return false
+	}
+	for _, part := range strings.Split(dashboardpath, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetGridsterLayout(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		positions []widgetPosition
+		want      string
+	}{
+		{
+			"attributes replaced",
+			`<li data-row="1" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 2, 3, 4, 5}},
+			`<li data-row="2" data-col="3" data-sizex="4" data-sizey="5"><div data-id="a"></div></li>`,
+		},
+		{
+			"attributes added",
+			`<LI class="x"><div data-id='a'></div></LI>`,
+			[]widgetPosition{{"a", 2, 3, 4, 5}},
+			`<LI class="x" data-row="2" data-col="3" data-sizex="4" data-sizey="5"><div data-id='a'></div></LI>`,
+		},
+		{
+			"unquoted and spaced attributes",
+			`<li data-row=1 data-col = '1'><div data-id="a"></div>`,
+			[]widgetPosition{{"a", 2, 3, 4, 5}},
+			`<li data-row="2" data-col = "3" data-sizex="4" data-sizey="5"><div data-id="a"></div>`,
+		},
+		{
+			"shared ids in the order of the document",
+			`<li data-row="1"><div data-id="a"></div></li><li data-row="1"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}, {"a", 3, 1, 1, 1}},
+			`<li data-row="2" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li><li data-row="3" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+		},
+		{
+			"other widgets kept",
+			`<li data-row="1"><div data-id="a"></div></li><li data-row="1"><div data-id="b"></div></li>`,
+			[]widgetPosition{{"b", 2, 1, 1, 1}},
+			`<li data-row="1"><div data-id="a"></div></li><li data-row="2" data-col="1" data-sizex="1" data-sizey="1"><div data-id="b"></div></li>`,
+		},
+		{
+			"greater than in a quoted value",
+			`<li title="a > b" data-row="1"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}},
+			`<li title="a > b" data-row="2" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+		},
+		{
+			"gerb action in the tag",
+			`<li data-row="<%= row %>" class="<%= a > b %>"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}},
+			`<li data-row="<%= row %>" class="<%= a > b %>"><div data-id="a"></div></li>`,
+		},
+		{
+			"html/template action in the tag",
+			`<li {{if gt .a .b}}class="big"{{end}} data-row="1"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}},
+			`<li {{if gt .a .b}}class="big"{{end}} data-row="1"><div data-id="a"></div></li>`,
+		},
+		{
+			"action after a tag",
+			`<li data-row="1"><div data-id="a" data-title="<%= title %>"></div></li>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}},
+			`<li data-row="2" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a" data-title="<%= title %>"></div></li>`,
+		},
+		{
+			"position out of the grid",
+			`<li data-row="1" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+			[]widgetPosition{{"a", 0, 1, 1, 1}, {"a", 1, 1, -1, 1}},
+			`<li data-row="1" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+		},
+		{
+			"link tags",
+			`<link rel="x"><div data-id="a"></div>`,
+			[]widgetPosition{{"a", 2, 1, 1, 1}},
+			`<link rel="x"><div data-id="a"></div>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := setGridsterLayout(tt.content, tt.positions); got != tt.want {
+			t.Errorf("%s :\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutHandler(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/main.gerb": `<li data-row="1" data-col="1" data-sizex="1" data-sizey="1"><div data-id="a"></div></li>`,
+	})
+	defer cleanup()
+	s.history = NewHistory(s.webroot)
+
+	tests := []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"widgets": [{"id": "a", "row": 0, "col": 1, "sizex": 1, "sizey": 1}]}`, 400, `data-row="1" data-col="1"`},
+		{`{"widgets": [{"id": "a", "row": 1, "col": 1, "sizex": 0, "sizey": 1}]}`, 400, `data-row="1" data-col="1"`},
+		{`{"widgets": [`, 400, `data-row="1" data-col="1"`},
+		{`{"widgets": [{"id": "a", "row": 2, "col": 3, "sizex": 1, "sizey": 1}]}`, 200, `data-row="2" data-col="3"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.LayoutHandler(w, httptest.NewRequest("POST", "/layouts/main?:_name=main", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.body, w.Code, tt.status)
+		}
+		content, _ := ioutil.ReadFile(filepath.Join(s.webroot, "dashboards", "main.gerb"))
+		if !strings.Contains(string(content), tt.want) {
+			t.Errorf("%s : dashboard %s, want %s", tt.body, content, tt.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package dashing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/karlseguin/gerb.v0"
+)
+
+// maxPartialDepth bounds the nesting of partials, to stop partials including
+// themselves.
+const maxPartialDepth = 10
+
+// helpers are the functions available to the templates as "helpers", with
+// the render context they were given.
+type helpers struct {
+	server  *Server
+	context map[string]interface{}
+	depth   int
+}
+
+// withHelpers adds the helpers to a render context.
+func (s *Server) withHelpers(context map[string]interface{}) map[string]interface{} {
+	context["helpers"] = &helpers{server: s, context: context}
+	return context
+}
+
+// pairs turns a list of alternating names and values into a map.
+func pairs(args []interface{}) (map[string]interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("odd number of arguments")
+	}
+	m := map[string]interface{}{}
+	for i := 0; i < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("argument name %v is not a string", args[i])
+		}
+		m[name] = args[i+1]
+	}
+	return m, nil
+}
+
+// Partial renders partials/NAME.gerb, or partials/NAME.tmpl, with the render
+// context, plus the arguments, given as alternating names and values. The
+// arguments are also available as "args".
+func (h *helpers) Partial(name string, args ...interface{}) string {
+	if h.depth >= maxPartialDepth {
+		return h.fail("partial "+name, fmt.Errorf("more than %d nested partials", maxPartialDepth))
+	}
+	if !validDashboardPath(name) {
+		return h.fail("partial "+name, fmt.Errorf("invalid name"))
+	}
+	values, err := pairs(args)
+	if err != nil {
+		return h.fail("partial "+name, err)
+	}
+
+	content, ext, err := h.server.getPartial(name)
+	if err != nil {
+		return h.fail("partial "+name, err)
+	}
+
+	context := map[string]interface{}{}
+	for k, v := range h.context {
+		context[k] = v
+	}
+	for k, v := range values {
+		context[k] = v
+	}
+	context["args"] = values
+	context["helpers"] = &helpers{server: h.server, context: context, depth: h.depth + 1}
+
+	if ext == ".tmpl" {
+		out, err := renderHTMLPartial(content, context)
+		if err != nil {
+			return h.fail("partial "+name, err)
+		}
+		return out
+	}
+
+	template, err := gerb.ParseString(true, content)
+	if err != nil {
+		return h.fail("partial "+name, err)
+	}
+	var out bytes.Buffer
+	template.Render(&out, context)
+	return out.String()
+}
+
+// Env returns the value of an environment variable. Only the variables
+// starting with DASHING_ are available, to keep secrets out of the pages.
+func (h *helpers) Env(name string) string {
+	if !strings.HasPrefix(name, "DASHING_") {
+		log.Printf("Template : environment variable %s is not available, only DASHING_* ones are", name)
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// Config returns the value of conf/templates.toml at a dotted key, like
+// "jira.url".
+func (h *helpers) Config(key string) interface{} {
+	var value interface{} = h.server.getTemplatesConfig()
+	for _, part := range strings.Split(key, ".") {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = table[part]
+	}
+	return value
+}
+
+// getPartial returns the content of partials/NAME.gerb, or of
+// partials/NAME.tmpl, from the asset layers, and its extension.
+func (s *Server) getPartial(name string) (string, string, error) {
+	type partial struct{ content, ext string }
+	v, err := s.fromCache("partial:"+name, func() (interface{}, error) {
+		for _, ext := range []string{".gerb", ".tmpl"} {
+			if content, _, err := s.assets().ReadFile("partials", name+ext); err == nil {
+				return partial{string(content), ext}, nil
+			}
+		}
+		return nil, fmt.Errorf("partials/%s.gerb not found, tried %s", name, strings.Join(s.assets().lookups("partials", name+".gerb"), ", "))
+	})
+	if err != nil {
+		return "", "", err
+	}
+	p := v.(partial)
+	return p.content, p.ext, nil
+}
+
+// getTemplatesConfig returns the tables of conf/templates.toml, empty when
+// it can not be read.
+func (s *Server) getTemplatesConfig() map[string]interface{} {
+	v, _ := s.fromCache("templates.toml", func() (interface{}, error) {
+		config := map[string]interface{}{}
+		if _, err := toml.DecodeFile(s.webroot+"conf/templates.toml", &config); err != nil {
+			log.Printf("Template : can not read config file %s : %s", "conf/templates.toml", err)
+		}
+		return config, nil
+	})
+	return v.(map[string]interface{})
+}
+
+// Number formats a number with thousands separators and a number of
+// decimals.
+func (h *helpers) Number(value interface{}, decimals int) string {
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	integer, fraction := s, ""
+	if i := strings.Index(s, "."); i != -1 {
+		integer, fraction = s[:i], s[i:]
+	}
+
+	var out bytes.Buffer
+	if f < 0 {
+		out.WriteByte('-')
+	}
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+		out.WriteRune(c)
+	}
+	out.WriteString(fraction)
+	return out.String()
+}
+
+// Date formats a time, a unix timestamp or a RFC 3339 date with a Go time
+// layout.
+func (h *helpers) Date(value interface{}, layout string) string {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return v
+		}
+		t = parsed
+	default:
+		f, ok := toFloat(value)
+		if !ok {
+			return fmt.Sprint(value)
+		}
+		t = time.Unix(int64(f), 0)
+	}
+	return t.Format(layout)
+}
+
+// JSON encodes a value in JSON, to be output unescaped with <%! %>.
+func (h *helpers) JSON(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return h.fail("json", err)
+	}
+	return string(content)
+}
+
+var (
+	widgetAttributeRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	widgetIDCharsRegex   = regexp.MustCompile(`^[^\s"'<>&]+$`)
+)
+
+// Widget returns the markup of a widget of type view, followed by its
+// attributes given as alternating names and values, the data- prefix being
+// added to names without a data- or jira- one. The size of the manifest of
+// the widget gives the default data-sizex and data-sizey.
+func (h *helpers) Widget(view string, id string, attrs ...interface{}) string {
+	if !h.server.widgetExists(view) {
+		return h.fail("widget "+id, fmt.Errorf("unknown widget type %s", view))
+	}
+	if !widgetIDCharsRegex.MatchString(id) {
+		return h.fail("widget "+id, fmt.Errorf("invalid id"))
+	}
+	if len(attrs)%2 != 0 {
+		return h.fail("widget "+id, fmt.Errorf("odd number of attributes"))
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<div data-id="%s" data-view="%s"`, id, html.EscapeString(view))
+	names := []string{}
+	for i := 0; i < len(attrs); i += 2 {
+		name, ok := attrs[i].(string)
+		if !ok || !widgetAttributeRegex.MatchString(name) {
+			return h.fail("widget "+id, fmt.Errorf("invalid attribute name %v", attrs[i]))
+		}
+		if name == "data-id" || name == "data-view" || name == "id" || name == "view" {
+			return h.fail("widget "+id, fmt.Errorf("attribute %s is set by the helper", name))
+		}
+		if !strings.HasPrefix(name, "data-") && !strings.HasPrefix(name, "jira-") {
+			name = "data-" + name
+		}
+		fmt.Fprintf(&out, ` %s="%s"`, name, html.EscapeString(fmt.Sprint(attrs[i+1])))
+		names = append(names, name)
+	}
+	if size := h.server.widgetSize(view); size.Sizex > 0 {
+		if !stringInSlice("data-sizex", names) {
+			fmt.Fprintf(&out, ` data-sizex="%d"`, size.Sizex)
+		}
+		if !stringInSlice("data-sizey", names) {
+			fmt.Fprintf(&out, ` data-sizey="%d"`, size.Sizey)
+		}
+	}
+	out.WriteString("></div>")
+	return out.String()
+}
+
+// fail logs a helper error and returns it as a HTML comment.
+func (h *helpers) fail(what string, err error) string {
+	log.Printf("Template : %s : %s", what, err)
+	return fmt.Sprintf("<!-- %s : %s -->", html.EscapeString(what), html.EscapeString(err.Error()))
+}
+
+// widgetExists tells whether a widget type is in the widgets folder or
+// embedded.
+func (s *Server) widgetExists(view string) bool {
+	if !validDashboardPath(view) || strings.Contains(view, "/") {
+		return false
+	}
+	for _, name := range []string{view, strings.ToLower(view), CamelCase(view)} {
+		if _, _, err := s.fileGetContent(name+"/"+name+".html", "widgets"); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
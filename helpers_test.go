@@ -0,0 +1,156 @@
+package dashing
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPartialHelper(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"partials/tile.gerb":   `<li><%= title %> <%= args.id %> <%= dashboard %></li>`,
+		"partials/loop.gerb":   `x<%! helpers.Partial("loop") %>`,
+		"partials/inner.gerb":  `[<%! helpers.Partial("tile", "title", "inner", "id", id) %>]`,
+		"partials/html.tmpl":   `<b>{{.title}}</b>`,
+		"partials/broken.gerb": `<% if %>`,
+	})
+	defer cleanup()
+	h := s.withHelpers(map[string]interface{}{"dashboard": "sales", "title": "context"})["helpers"].(*helpers)
+
+	tests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{"tile", []interface{}{"title", "Sales", "id", "q1"}, `<li>Sales q1 sales</li>`},
+		{"tile", []interface{}{"title", "<b>", "id", "q1"}, `<li>&lt;b&gt; q1 sales</li>`},
+		{"tile", []interface{}{"id", "q1"}, `<li>context q1 sales</li>`},
+		{"inner", []interface{}{"id", "q2"}, `[<li>inner q2 sales</li>]`},
+		{"html", []interface{}{"title", "<i>"}, `<b>&lt;i&gt;</b>`},
+		{"tile", []interface{}{"title"}, `<!-- partial tile : odd number of arguments -->`},
+		{"tile", []interface{}{1, "a"}, `<!-- partial tile : argument name 1 is not a string -->`},
+		{"../conf/x", nil, `<!-- partial ../conf/x : invalid name -->`},
+		{"missing", nil, `<!-- partial missing : partials/missing.gerb not found`},
+	}
+	for _, tt := range tests {
+		if got := h.Partial(tt.name, tt.args...); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("Partial(%s, %v) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+
+	loop := h.Partial("loop")
+	if got, want := strings.Count(loop, "x"), maxPartialDepth; got != want {
+		t.Errorf("partial including itself : %d levels, want %d", got, want)
+	}
+	if !strings.HasSuffix(loop, "<!-- partial loop : more than 10 nested partials -->") {
+		t.Errorf("partial including itself : %q, want the depth error", loop)
+	}
+	if got := h.Partial("broken"); !strings.HasPrefix(got, "<!-- partial broken : ") {
+		t.Errorf("invalid partial : %q, want the error", got)
+	}
+}
+
+func TestWidgetHelper(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"widgets/Gauge/Gauge.html": "",
+	})
+	defer cleanup()
+	h := &helpers{server: s}
+
+	tests := []struct {
+		view  string
+		id    string
+		attrs []interface{}
+		want  string
+	}{
+		{"Gauge", "a", []interface{}{"title", "Load", "jira-jql", "project = OPS", "data-max", 10}, `<div data-id="a" data-view="Gauge" data-title="Load" jira-jql="project = OPS" data-max="10"></div>`},
+		{"gauge", "a", nil, `<div data-id="a" data-view="gauge"></div>`},
+		{"Gauge", "a", []interface{}{"title", `"><script>alert(1)</script>`}, `<div data-id="a" data-view="Gauge" data-title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"></div>`},
+		{"Gauge", `a"b`, nil, `<!-- widget a&#34;b : invalid id -->`},
+		{"Gauge", "a b", nil, `<!-- widget a b : invalid id -->`},
+		{"Gauge", "a", []interface{}{"title"}, `<!-- widget a : odd number of attributes -->`},
+		{"Gauge", "a", []interface{}{"on click", "x"}, `<!-- widget a : invalid attribute name on click -->`},
+		{"Gauge", "a", []interface{}{"Title", "x"}, `<!-- widget a : invalid attribute name Title -->`},
+		{"Gauge", "a", []interface{}{"view", "Number"}, `<!-- widget a : attribute view is set by the helper -->`},
+		{"Gauge", "a", []interface{}{"data-id", "b"}, `<!-- widget a : attribute data-id is set by the helper -->`},
+		{"Nope", "a", nil, `<!-- widget a : unknown widget type Nope -->`},
+		{"../Gauge", "a", nil, `<!-- widget a : unknown widget type ../Gauge -->`},
+		{"Gauge", "a", []interface{}{"title", "--><b>"}, `<div data-id="a" data-view="Gauge" data-title="--&gt;&lt;b&gt;"></div>`},
+	}
+	for _, tt := range tests {
+		if got := h.Widget(tt.view, tt.id, tt.attrs...); got != tt.want {
+			t.Errorf("Widget(%s, %s, %v) = %s, want %s", tt.view, tt.id, tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestFormatHelpers(t *testing.T) {
+	h := &helpers{}
+	numbers := []struct {
+		value    interface{}
+		decimals int
+		want     string
+	}{
+		{1234.5, 2, "1,234.50"},
+		{-1234567, 0, "-1,234,567"},
+		{"999.99", 1, "1,000.0"},
+		{12, 0, "12"},
+		{"n/a", 0, "n/a"},
+	}
+	for _, tt := range numbers {
+		if got := h.Number(tt.value, tt.decimals); got != tt.want {
+			t.Errorf("Number(%v, %d) = %s, want %s", tt.value, tt.decimals, got, tt.want)
+		}
+	}
+
+	date := time.Date(2016, 3, 1, 14, 5, 0, 0, time.UTC)
+	dates := []struct {
+		value interface{}
+		want  string
+	}{
+		{date, "2016-03-01 14:05"},
+		{"2016-03-01T14:05:00Z", "2016-03-01 14:05"},
+		{"yesterday", "yesterday"},
+		{float64(date.Unix()), date.Local().Format("2006-01-02 15:04")},
+	}
+	for _, tt := range dates {
+		if got := h.Date(tt.value, "2006-01-02 15:04"); got != tt.want {
+			t.Errorf("Date(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	if got, want := h.JSON(map[string]interface{}{"a": []int{1, 2}}), `{"a":[1,2]}`; got != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+	if got := h.JSON(func() {}); !strings.HasPrefix(got, "<!-- json : ") {
+		t.Errorf("JSON of a function = %s, want the error", got)
+	}
+
+	os.Setenv("DASHING_REGION", "emea")
+	os.Setenv("SECRET_TOKEN", "secret")
+	defer os.Unsetenv("DASHING_REGION")
+	defer os.Unsetenv("SECRET_TOKEN")
+	if got := h.Env("DASHING_REGION"); got != "emea" {
+		t.Errorf("Env(DASHING_REGION) = %s, want emea", got)
+	}
+	if got := h.Env("SECRET_TOKEN"); got != "" {
+		t.Errorf("Env(SECRET_TOKEN) = %s, want nothing", got)
+	}
+}
+
+func TestHTMLHelpers(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"widgets/Gauge/Gauge.html": "",
+		"partials/tile.gerb":       `<li><%= title %></li>`,
+		"conf/templates.toml":      "[jira]\nproject = \"OPS\"\n",
+	})
+	defer cleanup()
+
+	context := s.withHelpers(map[string]interface{}{"value": []string{"</script>"}})
+	expanded, err := expandHTMLDashboard(`{{.helpers.Widget "Gauge" "a" "title" "<b>"}}{{.helpers.Partial "tile" "title" "<i>"}}<script>var v = {{.helpers.JSON .value}};</script>{{.helpers.Config "jira.project"}}`, context)
+	want := `<div data-id="a" data-view="Gauge" data-title="&lt;b&gt;"></div><li>&lt;i&gt;</li><script>var v = ["\u003c/script\u003e"];</script>OPS`
+	if err != nil || expanded != want {
+		t.Errorf("expandHTMLDashboard = %q, %v, want %q", expanded, err, want)
+	}
+}
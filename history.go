@@ -0,0 +1,342 @@
+package dashing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Version is a snapshot of a dashboard, taken each time the server writes
+// it.
+type Version struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Author string    `json:"author"`
+	Action string    `json:"action"`
+}
+
+// A History keeps the versions of the dashboards in the .history folder of
+// the webroot, the versions of dashboards/team/sales.gerb being stored in
+// .history/team/sales.gerb/, and those of a .tmpl dashboard in a .tmpl one.
+type History struct {
+	root string
+}
+
+// ErrVersionNotFound is returned when a dashboard has no such version.
+var ErrVersionNotFound = errors.New("version not found")
+
+// NewHistory returns the history of the dashboards of a webroot.
+func NewHistory(webroot string) *History {
+	return &History{root: webroot}
+}
+
+// ext returns the extension of the format of a dashboard, from its file or,
+// once deleted, from its history.
+func (h *History) ext(dashboardpath string) string {
+	for _, folder := range []string{"dashboards", ".history"} {
+		for _, ext := range dashboardExts {
+			if _, err := os.Stat(filepath.Join(h.root, folder, filepath.FromSlash(dashboardpath)+ext)); err == nil {
+				return ext
+			}
+		}
+	}
+	return ".gerb"
+}
+
+func (h *History) folder(dashboardpath string) string {
+	return filepath.Join(h.root, ".history", filepath.FromSlash(dashboardpath)+h.ext(dashboardpath))
+}
+
+func (h *History) dashboardFile(dashboardpath string) string {
+	return filepath.Join(h.root, "dashboards", filepath.FromSlash(dashboardpath)+h.ext(dashboardpath))
+}
+
+// Versions returns the versions of a dashboard, the most recent first.
+func (h *History) Versions(dashboardpath string) ([]Version, error) {
+	versions := []Version{}
+	files, err := ioutil.ReadDir(h.folder(dashboardpath))
+	if os.IsNotExist(err) {
+		return versions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(h.folder(dashboardpath), f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var v Version
+		if err := json.Unmarshal(content, &v); err != nil {
+			return nil, fmt.Errorf("%s : %s", f.Name(), err)
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+// Content returns the content of a version of a dashboard, or its current
+// content when id is "current".
+func (h *History) Content(dashboardpath string, id string) ([]byte, error) {
+	if id == "current" {
+		return ioutil.ReadFile(h.dashboardFile(dashboardpath))
+	}
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrVersionNotFound
+	}
+	content, err := ioutil.ReadFile(filepath.Join(h.folder(dashboardpath), id+h.ext(dashboardpath)))
+	if os.IsNotExist(err) {
+		return nil, ErrVersionNotFound
+	}
+	return content, err
+}
+
+// Record snapshots a content of a dashboard. When the dashboard has no
+// history yet, its previous content, if any, is recorded first.
+func (h *History) Record(dashboardpath string, previous []byte, content []byte, author string, action string) (Version, error) {
+	if previous != nil {
+		if versions, err := h.Versions(dashboardpath); err == nil && len(versions) == 0 {
+			if _, err := h.write(dashboardpath, previous, "", "original"); err != nil {
+				return Version{}, err
+			}
+		}
+	}
+	return h.write(dashboardpath, content, author, action)
+}
+
+func (h *History) write(dashboardpath string, content []byte, author string, action string) (Version, error) {
+	folder := h.folder(dashboardpath)
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		return Version{}, err
+	}
+
+	v := Version{Time: time.Now(), Author: author, Action: action}
+	v.ID = v.Time.UTC().Format("20060102T150405.000000000Z")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(folder, v.ID+".json")); os.IsNotExist(err) {
+			break
+		}
+		v.ID = fmt.Sprintf("%s-%d", strings.SplitN(v.ID, "-", 2)[0], i)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(folder, v.ID+h.ext(dashboardpath)), content, 0644); err != nil {
+		return Version{}, err
+	}
+	meta, _ := json.MarshalIndent(v, "", "  ")
+	if err := ioutil.WriteFile(filepath.Join(folder, v.ID+".json"), meta, 0644); err != nil {
+		return Version{}, err
+	}
+	return v, nil
+}
+
+// Restore writes a version back to the dashboard file, recording the
+// restoration as a new version.
+func (h *History) Restore(dashboardpath string, id string, author string) (Version, error) {
+	content, err := h.Content(dashboardpath, id)
+	if err != nil {
+		return Version{}, err
+	}
+
+	file := h.dashboardFile(dashboardpath)
+	previous, err := ioutil.ReadFile(file)
+	if err != nil {
+		previous = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return Version{}, err
+	}
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		return Version{}, err
+	}
+	return h.Record(dashboardpath, previous, content, author, "restore "+id)
+}
+
+// Move moves the history of a dashboard, or of every dashboard of a folder
+// when ext is empty, along with it.
+func (h *History) Move(from string, to string, ext string) error {
+	source := filepath.Join(h.root, ".history", filepath.FromSlash(from)+ext)
+	if _, err := os.Stat(source); os.IsNotExist(err) {
+		return nil
+	}
+	target := filepath.Join(h.root, ".history", filepath.FromSlash(to)+ext)
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	return os.Rename(source, target)
+}
+
+// Diff returns the unified diff between two versions of a dashboard, "current"
+// being its current content.
+func (h *History) Diff(dashboardpath string, from string, to string) (string, error) {
+	a, err := h.Content(dashboardpath, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := h.Content(dashboardpath, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(dashboardpath+"@"+from, dashboardpath+"@"+to, a, b), nil
+}
+
+// A diffOp is a line kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// maxDiffCells bounds the size of the LCS table, beyond it the changed lines
+// are all reported as removed then added.
+const maxDiffCells = 4000000
+
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the operations turning a into b, from their longest
+// common subsequence.
+func diffLines(a []string, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := []diffOp{}
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(x), len(y)
+	if (n+1)*(m+1) > maxDiffCells {
+		for _, l := range x {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range y {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && x[i] == y[j]:
+				ops = append(ops, diffOp{' ', x[i]})
+				i++
+				j++
+			case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, diffOp{'-', x[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', y[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// unifiedDiff returns the changes from a to b in the unified format, with
+// three lines of context.
+func unifiedDiff(fromName string, toName string, a []byte, b []byte) string {
+	const context = 3
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Line numbers in a and b before each operation
+	aLines, bLines := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	changes := []int{}
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.kind != '+' {
+			aLines[i+1]++
+		}
+		if op.kind != '-' {
+			bLines[i+1]++
+		}
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for c := 0; c < len(changes); {
+		start := changes[c] - context
+		if start < 0 {
+			start = 0
+		}
+		last := changes[c]
+		for c++; c < len(changes) && changes[c]-last <= 2*context; c++ {
+			last = changes[c]
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[end]-aLines[start]),
+			hunkRange(bLines[start], bLines[end]-bLines[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+func hunkRange(start int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
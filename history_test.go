@@ -0,0 +1,74 @@
+package dashing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		// want are the operations, one per line, the kind before the line
+		want string
+	}{
+		{"same", "a\nb\n", "a\nb\n", " a  b"},
+		{"both empty", "", "", ""},
+		{"added to an empty file", "", "a\nb\n", "+a +b"},
+		{"all removed", "a\nb\n", "", "-a -b"},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", " a -b +x  c"},
+		{"inserted line", "a\nc\n", "a\nb\nc\n", " a +b  c"},
+		{"removed line", "a\nb\nc\n", "a\nc\n", " a -b  c"},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", "-a  b  c +a"},
+		{"longest common subsequence", "a\nb\nc\nd\ne\n", "x\nb\nd\ny\ne\n", "-a +x  b -c  d +y  e"},
+		{"missing last line break", "a\nb", "a\nb\n", " a -b +b"},
+	}
+	for _, tt := range tests {
+		ops := []string{}
+		for _, op := range diffLines(splitLines([]byte(tt.a)), splitLines([]byte(tt.b))) {
+			ops = append(ops, string(op.kind)+strings.TrimSuffix(op.line, "\n"))
+		}
+		if got := strings.Join(ops, " "); got != tt.want {
+			t.Errorf("%s : diffLines = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"no change", "a\n", "a\n", ""},
+		{
+			"one hunk",
+			"1\n2\n3\n4\n5\n",
+			"1\n2\nx\n4\n5\n",
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n 2\n-3\n+x\n 4\n 5\n",
+		},
+		{
+			"two hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			"new file",
+			"",
+			"a\n",
+			"--- a\n+++ b\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			"no newline at end of file",
+			"a\n",
+			"a\nb",
+			"--- a\n+++ b\n@@ -1,1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("a", "b", []byte(tt.a), []byte(tt.b)); got != tt.want {
+			t.Errorf("%s : unifiedDiff =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
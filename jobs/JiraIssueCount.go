@@ -2,11 +2,11 @@ package jobs
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/fsnotify.v1"
@@ -31,6 +31,8 @@ type jiraIssueConfig struct {
 }
 
 type JiraIssurConfigIndicator struct {
+	WidgetID     string
+	Namespace    string
 	Jql          string
 	WarningOver  int
 	DangerOver   int
@@ -57,10 +59,10 @@ func (j *jiraIssueCount) Work(send chan *dashing.Event, webroot string, url stri
 	}
 
 	// Capture indicators from dashbords
-	j.readIndicators(webroot + "dashboards/")
+	j.readIndicators(webroot)
 	j.pushData(send)
 
-	go j.watchChanges(webroot + "dashboards/")
+	go j.watchChanges(webroot)
 
 	ticker := time.NewTicker(time.Duration(j.config.Interval) * time.Second)
 	for {
@@ -72,22 +74,25 @@ func (j *jiraIssueCount) Work(send chan *dashing.Event, webroot string, url stri
 }
 
 func (j *jiraIssueCount) pushData(send chan *dashing.Event) {
-	for WID, indicator := range j.config.Indicators.Items() {
-		count, err := j.getNumberOfIssues(indicator.(JiraIssurConfigIndicator).Jql)
+	for _, item := range j.config.Indicators.Items() {
+		indicator := item.(JiraIssurConfigIndicator)
+		count, err := j.getNumberOfIssues(indicator.Jql)
 		if err != nil {
 			log.Printf("JiraJob : error jira search : %s", err)
 			continue
 		}
 
-		status, _ := j.getIndicatorStatus(count, indicator.(JiraIssurConfigIndicator))
+		status, _ := j.getIndicatorStatus(count, indicator)
 
-		send <- dashing.NewEvent(
-			WID,
+		event := dashing.NewEvent(
+			indicator.WidgetID,
 			map[string]interface{}{
 				"current": count,
 				"status":  status,
 			},
 			"")
+		event.Namespace = indicator.Namespace
+		send <- event
 
 	}
 }
@@ -141,25 +146,32 @@ func (j *jiraIssueCount) getNumberOfIssues(jql string) (int, error) {
 
 }
 
-func (j *jiraIssueCount) readIndicators(dashroot string) {
+func (j *jiraIssueCount) readIndicators(webroot string) {
 	//init empty Indicators
 	for k := range j.config.Indicators.Items() {
 		j.config.Indicators.Remove(k)
 	}
 
-	// open each gerb
-	files, _ := filepath.Glob(dashroot + "**/*.gerb")
-	files2, _ := filepath.Glob(dashroot + "*.gerb")
-	files = append(files, files2...)
+	// open each dashboard of the asset layers, of any format and folder depth
+	files := dashing.DashboardFiles(webroot)
+	// a parameterised dashboard is read once per value of its parameters
+	variants := []string{}
+	// the widgets of a dashboard are in its namespace
+	namespaces := []string{}
 	for _, file := range files {
-		reader, err := os.Open(file)
+		expanded, err := dashing.DashboardVariants(webroot, file)
 		if err != nil {
-			log.Println("JiraJob : error openning file : " + err.Error())
+			log.Println("JiraJob : error expanding file : " + err.Error())
 			continue
 		}
+		variants = append(variants, expanded...)
+		for range expanded {
+			namespaces = append(namespaces, dashing.DashboardNamespace(webroot, file))
+		}
+	}
 
-		doc, err := goquery.NewDocumentFromReader(reader)
-		reader.Close()
+	for v, variant := range variants {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(variant))
 		if err != nil {
 			log.Println("JiraJob : error goquery file : " + err.Error())
 			continue
@@ -189,8 +201,10 @@ func (j *jiraIssueCount) readIndicators(dashroot string) {
 			warningUnder, _ = strconv.Atoi(warningUnderString)
 
 			// register indicator
-			j.config.Indicators.Set(widgetID,
+			j.config.Indicators.Set(namespaces[v]+"/"+widgetID,
 				JiraIssurConfigIndicator{
+					WidgetID:     widgetID,
+					Namespace:    namespaces[v],
 					Jql:          "filter=" + jql,
 					Interval:     jobInterval,
 					DangerOver:   dangerOver,
@@ -224,8 +238,10 @@ func (j *jiraIssueCount) readIndicators(dashroot string) {
 			warningUnder, _ = strconv.Atoi(warningUnderString)
 
 			// register indicator
-			j.config.Indicators.Set(widgetID,
+			j.config.Indicators.Set(namespaces[v]+"/"+widgetID,
 				JiraIssurConfigIndicator{
+					WidgetID:     widgetID,
+					Namespace:    namespaces[v],
 					Jql:          jql,
 					Interval:     jobInterval,
 					DangerOver:   dangerOver,
@@ -237,7 +253,9 @@ func (j *jiraIssueCount) readIndicators(dashroot string) {
 	}
 }
 
-func (j *jiraIssueCount) watchChanges(dashroot string) {
+// watchChanges reads the indicators again when a dashboard or a partial
+// changes.
+func (j *jiraIssueCount) watchChanges(webroot string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Fatal(err)
@@ -250,17 +268,15 @@ func (j *jiraIssueCount) watchChanges(dashroot string) {
 			select {
 			case event := <-watcher.Events:
 				if event.Op&fsnotify.Write == fsnotify.Write {
-					j.readIndicators(dashroot)
+					j.readIndicators(webroot)
 				}
 
 				if event.Op&fsnotify.Create == fsnotify.Create {
-					f, _ := os.Stat(event.Name)
-					if f.IsDir() {
-						err = watcher.Add(dashroot + f.Name())
-						if err != nil {
-							log.Println(err)
-						}
+					f, err := os.Stat(event.Name)
+					if err == nil && f.IsDir() {
+						j.watchFolders(watcher, event.Name)
 					}
+					j.readIndicators(webroot)
 				}
 
 			case err := <-watcher.Errors:
@@ -269,25 +285,26 @@ func (j *jiraIssueCount) watchChanges(dashroot string) {
 		}
 	}()
 
-	err = watcher.Add(dashroot)
-	if err != nil {
-		log.Println(err)
-	}
-	files, _ := ioutil.ReadDir(dashroot)
-	for _, f := range files {
-		if f.IsDir() {
-			err = watcher.Add(dashroot + f.Name())
-			if err != nil {
-				log.Println(err)
-			}
-		}
-
-	}
+	j.watchFolders(watcher, webroot+"dashboards/")
+	j.watchFolders(watcher, webroot+"partials/")
 
 	<-done
 
 }
 
+// watchFolders adds a folder and all its sub folders to the watcher.
+func (j *jiraIssueCount) watchFolders(watcher *fsnotify.Watcher, root string) {
+	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil || !f.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Println(err)
+		}
+		return nil
+	})
+}
+
 func init() {
-	dashing.Register(&jiraIssueCount{})
+	dashing.RegisterFactory(func() dashing.Job { return &jiraIssueCount{} })
 }
@@ -19,10 +19,12 @@ import (
 )
 
 type execJob struct {
-	tasks cmap.ConcurrentMap
-	send  chan *dashing.Event
-	url   string
-	token string
+	tasks      cmap.ConcurrentMap
+	send       chan *dashing.Event
+	webroot    string
+	url        string
+	token      string
+	validation string
 }
 
 type task struct {
@@ -31,9 +33,14 @@ type task struct {
 	interval int
 	path     string
 	widgetID string
-	job      *scheduler.Job
-	url      string
-	token    string
+	// namespace of the widget, declared by the sub folder of the task
+	namespace string
+	job       *scheduler.Job
+	webroot   string
+	url       string
+	token     string
+	// validation is the handling of the data not matching the schemas
+	validation string
 }
 
 const (
@@ -44,15 +51,27 @@ const (
 func (j *execJob) Work(send chan *dashing.Event, webroot string, url string, token string) {
 	j.tasks = cmap.New()
 	j.send = send
+	j.webroot = webroot
 	j.url = url
 	j.token = token
-	j.readDir(webroot + "jobs/")
+	j.validation = dashing.ValidationMode()
+	j.readDir(webroot+"jobs/", "")
 
 	j.watchChanges(webroot + "jobs/")
 }
 
-func (j *execJob) readDir(jobspath string) {
-	files, _ := filepath.Glob(jobspath + "*")
+// readDir schedules the new tasks of a folder, or of one of its sub folders.
+// The tasks of a sub folder push to the widgets of the namespace declared by
+// its folder.toml, the sub folders declaring none being ignored.
+func (j *execJob) readDir(jobspath string, folder string) {
+	namespace := ""
+	if folder != "" {
+		namespace = dashing.JobsNamespace(jobspath + folder)
+		if namespace == "" {
+			return
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(jobspath, folder, "*"))
 
 	// Add new tasks
 	for _, file := range files {
@@ -63,12 +82,26 @@ func (j *execJob) readDir(jobspath string) {
 
 		//Is file ?
 		fileInfo, err := os.Stat(file)
-		if err != nil || fileInfo.IsDir() {
+		if err != nil {
+			continue
+		}
+		if fileInfo.IsDir() {
+			if folder == "" {
+				j.readDir(jobspath, filename)
+			}
+			continue
+		}
+		if filename == "folder.toml" {
 			continue
 		}
 
+		key := filename
+		if folder != "" {
+			key = folder + "/" + filename
+		}
+
 		// Already registered
-		if j.tasks.Has(filename) {
+		if j.tasks.Has(key) {
 			continue
 		}
 
@@ -87,9 +120,12 @@ func (j *execJob) readDir(jobspath string) {
 		t.path = file
 		t.interval = interval
 		t.widgetID = s[1]
-		t.name = filename
+		t.namespace = namespace
+		t.name = key
+		t.webroot = j.webroot
 		t.url = j.url
 		t.token = j.token
+		t.validation = j.validation
 		switch extension {
 		case ".php":
 			t.executor = XPHP
@@ -133,13 +169,28 @@ func (t *task) start(send chan *dashing.Event) {
 			return
 		}
 
-		send <- dashing.NewEvent(t.widgetID, j, "")
+		// The data are checked against the schemas of the widgets showing
+		// them
+		if t.validation != dashing.ValidationOff {
+			if errs := dashing.WidgetSchemasOf(t.webroot).Validate(t.namespace, t.widgetID, j); len(errs) > 0 {
+				for _, e := range errs {
+					log.Printf("ExecJob - %s - invalid data - %s", t.name, e)
+				}
+				if t.validation == dashing.ValidationStrict {
+					return
+				}
+			}
+		}
+
+		event := dashing.NewEvent(t.widgetID, j, "")
+		event.Namespace = t.namespace
+		send <- event
 
 		//log.Printf("JOB - %s - run - %s", t.name, data)
 	})
 
 	if err != nil {
-		log.Printf("ExecJob - %s - scheduler error %s : %s", t.name, t.path, err.Error)
+		log.Printf("ExecJob - %s - scheduler error %s : %s", t.name, t.path, err.Error())
 		return
 	}
 	log.Printf("ExecJob - %s - scheduled every %ds", t.name, t.interval)
@@ -163,11 +214,18 @@ func doExec(command string, args ...string) (data []byte, err error) {
 	return
 }
 
+// Remove stops the task of a file, or the tasks of a sub folder.
 func (j *execJob) Remove(key string) {
 	if t, ok := j.tasks.Get(key); ok {
 		t.(*task).job.Quit <- true
 		j.tasks.Remove(key)
 	}
+	for k, t := range j.tasks.Items() {
+		if strings.HasPrefix(k, key+"/") {
+			t.(*task).job.Quit <- true
+			j.tasks.Remove(k)
+		}
+	}
 }
 
 func (j *execJob) watchChanges(jobspath string) {
@@ -177,22 +235,34 @@ func (j *execJob) watchChanges(jobspath string) {
 	}
 	defer watcher.Close()
 
+	// The key of a task is its file name, prefixed by its sub folder
+	key := func(name string) string {
+		rel, err := filepath.Rel(jobspath, name)
+		if err != nil {
+			return filepath.Base(name)
+		}
+		return filepath.ToSlash(rel)
+	}
+
 	done := make(chan bool)
 	go func() {
 		for {
 			select {
 			case event := <-watcher.Events:
 				if event.Op&fsnotify.Create == fsnotify.Create {
-					j.readDir(jobspath)
+					if f, err := os.Stat(event.Name); err == nil && f.IsDir() && filepath.Dir(event.Name) == filepath.Clean(jobspath) {
+						watcher.Add(event.Name)
+					}
+					j.readDir(jobspath, "")
 				}
 				if event.Op&fsnotify.Write == fsnotify.Write {
-					j.readDir(jobspath)
+					j.readDir(jobspath, "")
 				}
 				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					j.Remove(filepath.Base(event.Name))
+					j.Remove(key(event.Name))
 				}
 				if event.Op&fsnotify.Rename == fsnotify.Rename {
-					j.Remove(filepath.Base(event.Name))
+					j.Remove(key(event.Name))
 				}
 			case err := <-watcher.Errors:
 				log.Printf("ExecJob error: %s", err)
@@ -204,10 +274,16 @@ func (j *execJob) watchChanges(jobspath string) {
 	if err != nil {
 		log.Println(err)
 	}
+	folders, _ := filepath.Glob(jobspath + "*")
+	for _, folder := range folders {
+		if f, err := os.Stat(folder); err == nil && f.IsDir() {
+			watcher.Add(folder)
+		}
+	}
 	<-done
 
 }
 
 func init() {
-	dashing.Register(&execJob{})
+	dashing.RegisterFactory(func() dashing.Job { return &execJob{} })
 }
@@ -0,0 +1,82 @@
+package dashing
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// frontMatterDelimiter opens and closes the front-matter block of a
+// dashboard.
+const frontMatterDelimiter = "+++"
+
+// DashboardMeta holds the metadata of a dashboard, read from an optional
+// TOML front-matter block between "+++" lines at the top of its .gerb or .tmpl file.
+type DashboardMeta struct {
+	Path        string   `toml:"-" json:"path"`
+	Name        string   `toml:"-" json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Owner       string   `json:"owner"`
+	Hidden      bool     `json:"hidden"`
+	// Number of seconds the dashboard is displayed during the rotation.
+	Duration int              `json:"duration"`
+	Params   []DashboardParam `toml:"param" json:"params"`
+	// Name of the layout of layouts/ and of the theme of themes/ of the
+	// dashboard.
+	Layout string `json:"layout"`
+	Theme  string `json:"theme"`
+	// Namespace of the widget IDs of the dashboard, resolving its data-id
+	// before the global ones.
+	Namespace string `json:"namespace"`
+}
+
+// parseFrontMatter splits a dashboard template into its metadata and its
+// body.
+func parseFrontMatter(content string) (DashboardMeta, string, error) {
+	var meta DashboardMeta
+
+	trimmed := strings.TrimLeft(content, "\ufeff \t\r\n")
+	if !strings.HasPrefix(trimmed, frontMatterDelimiter+"\n") && !strings.HasPrefix(trimmed, frontMatterDelimiter+"\r\n") {
+		return meta, content, nil
+	}
+
+	block := trimmed[strings.Index(trimmed, "\n")+1:]
+	end := strings.Index(block, "\n"+frontMatterDelimiter)
+	if end == -1 {
+		if !strings.HasPrefix(block, frontMatterDelimiter) {
+			return meta, content, nil
+		}
+		end = 0
+	}
+
+	if _, err := toml.Decode(block[:end], &meta); err != nil {
+		return meta, content, err
+	}
+
+	body := block[end:]
+	body = strings.TrimPrefix(body, "\n")
+	body = strings.TrimPrefix(body, frontMatterDelimiter)
+	return meta, body, nil
+}
+
+// getDashboardMeta returns the metadata of a dashboard, the dashboard name
+// being its title when it has none.
+func (s *Server) getDashboardMeta(dashboardpath string) DashboardMeta {
+	v, _ := s.fromCache("meta:"+dashboardpath, func() (interface{}, error) {
+		var meta DashboardMeta
+
+		if content, _, err := s.fileGetContent(dashboardpath+s.dashboardExt(dashboardpath), "dashboards"); err == nil {
+			meta, _, _ = parseFrontMatter(content)
+		}
+
+		meta.Path = dashboardpath
+		meta.Name = dashboardpath[strings.LastIndex(dashboardpath, "/")+1:]
+		if meta.Title == "" {
+			meta.Title = meta.Name
+		}
+		return meta, nil
+	})
+	return v.(DashboardMeta)
+}
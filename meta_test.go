@@ -0,0 +1,79 @@
+package dashing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		meta    DashboardMeta
+		body    string
+		err     bool
+	}{
+		{"none", "<div></div>", DashboardMeta{}, "<div></div>", false},
+		{
+			"fields",
+			"+++\ntitle = \"Sales\"\ntags = [\"a\", \"b\"]\nhidden = true\nduration = 30\n+++\n<div></div>",
+			DashboardMeta{Title: "Sales", Tags: []string{"a", "b"}, Hidden: true, Duration: 30},
+			"\n<div></div>",
+			false,
+		},
+		{
+			"params",
+			"+++\n[[param]]\nname = \"env\"\nvalues = [\"prod\", \"dev\"]\n+++\nbody",
+			DashboardMeta{Params: []DashboardParam{{Name: "env", Values: []string{"prod", "dev"}}}},
+			"\nbody",
+			false,
+		},
+		{"empty", "+++\n+++\nbody", DashboardMeta{}, "\nbody", false},
+		{"byte order mark and blank lines", "\ufeff\n\n+++\ntitle = \"A\"\n+++\nbody", DashboardMeta{Title: "A"}, "\nbody", false},
+		{"windows line breaks", "+++\r\ntitle = \"A\"\r\n+++\r\nbody", DashboardMeta{Title: "A"}, "\r\nbody", false},
+		{"not closed", "+++\ntitle = \"A\"\nbody", DashboardMeta{}, "+++\ntitle = \"A\"\nbody", false},
+		{"not at the start", "<div>\n+++\ntitle = \"A\"\n+++\n", DashboardMeta{}, "<div>\n+++\ntitle = \"A\"\n+++\n", false},
+		{"delimiter not alone", "+++ title\n+++\nbody", DashboardMeta{}, "+++ title\n+++\nbody", false},
+		{"invalid toml", "+++\ntitle = \n+++\nbody", DashboardMeta{}, "+++\ntitle = \n+++\nbody", true},
+	}
+	for _, tt := range tests {
+		meta, body, err := parseFrontMatter(tt.content)
+		if (err != nil) != tt.err {
+			t.Errorf("%s : error %v, want an error %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if !reflect.DeepEqual(meta, tt.meta) {
+			t.Errorf("%s : meta %+v, want %+v", tt.name, meta, tt.meta)
+		}
+		if body != tt.body {
+			t.Errorf("%s : body %q, want %q", tt.name, body, tt.body)
+		}
+	}
+}
+
+func TestGetDashboardMeta(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/sales/q1.gerb": "+++\ntitle = \"First quarter\"\n+++\n<div></div>",
+		"dashboards/plain.gerb":    "<div></div>",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		path  string
+		name  string
+		title string
+	}{
+		{"sales/q1", "q1", "First quarter"},
+		{"plain", "plain", "plain"},
+		{"missing", "missing", "missing"},
+	}
+	for _, tt := range tests {
+		meta := s.getDashboardMeta(tt.path)
+		if meta.Path != tt.path || meta.Name != tt.name || meta.Title != tt.title {
+			t.Errorf("%s : path %q, name %q, title %q, want %q, %q, %q", tt.path, meta.Path, meta.Name, meta.Title, tt.path, tt.name, tt.title)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package dashing
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// getNamespace returns the namespace of the widget IDs of a dashboard : the
+// one of its metadata, else the one of its folder, "" for the global one.
+func (s *Server) getNamespace(dashboardpath string) string {
+	if dashboardpath == "" {
+		return ""
+	}
+	file, _ := s.resolveDashboard(dashboardpath)
+	namespace := s.getDashboardMeta(file).Namespace
+	if namespace == "" {
+		namespace = s.getFolderSettings(file).Namespace
+	}
+	if namespace != "" && !nameRegex.MatchString(namespace) {
+		log.Printf("404 - %s - %s\n", "namespaces", namespace)
+		return ""
+	}
+	return namespace
+}
+
+// eventsURL returns the url of the events of a dashboard, naming the
+// namespace of its widget IDs.
+func (s *Server) eventsURL(dashboardpath string) string {
+	if namespace := s.getNamespace(dashboardpath); namespace != "" {
+		return s.prefix + "/events?namespace=" + url.QueryEscape(namespace)
+	}
+	return s.prefix + "/events"
+}
+
+// DashboardNamespace returns the namespace of the widget IDs of a dashboard
+// file of a webroot, given relative to the dashboards folders, for the jobs
+// reading the dashboards.
+func DashboardNamespace(webroot string, name string) string {
+	return serverOf(webroot).getNamespace(strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// JobsNamespace returns the namespace declared by the folder.toml of a sub
+// folder of the jobs, "" when it declares none, or when the folder or the
+// namespace has an invalid name.
+func JobsNamespace(folder string) string {
+	if !nameRegex.MatchString(filepath.Base(folder)) {
+		return ""
+	}
+	file := filepath.Join(folder, "folder.toml")
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	var settings folderSettings
+	if _, err := toml.DecodeFile(file, &settings); err != nil {
+		log.Printf("Jobs : can not read config file %s : %s", file, err)
+		return ""
+	}
+	if !nameRegex.MatchString(settings.Namespace) {
+		return ""
+	}
+	return settings.Namespace
+}
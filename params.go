@@ -0,0 +1,172 @@
+package dashing
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/karlseguin/gerb.v0"
+)
+
+// A DashboardParam is a parameter of a dashboard, declared by a [[param]]
+// table of its front-matter and given by the URL or the query string.
+type DashboardParam struct {
+	Name string `json:"name"`
+	// Values are the accepted values, the JIRA scanner, the rotation rules
+	// and the widget schemas expand the dashboard with each of them.
+	Values  []string `json:"values"`
+	Default string   `json:"default"`
+}
+
+// paramValues returns the value of each parameter of a dashboard, taken in
+// order from values, then from the query string, then from its default.
+func (m DashboardMeta) paramValues(values []string, query url.Values) (map[string]string, error) {
+	params := map[string]string{}
+	for i, p := range m.Params {
+		value := p.Default
+		if i < len(values) {
+			value = values[i]
+		} else if query.Get(p.Name) != "" {
+			value = query.Get(p.Name)
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("missing parameter %s", p.Name)
+		}
+		if len(p.Values) > 0 && !stringInSlice(value, p.Values) {
+			return nil, fmt.Errorf("invalid value %s for parameter %s", value, p.Name)
+		}
+		params[p.Name] = value
+	}
+	return params, nil
+}
+
+// resolveDashboard returns the dashboard serving a path, and the values of
+// its parameters given by the rest of the path : team/payments is served by
+// team.gerb with "payments" as its first parameter, when there is no
+// team/payments.gerb and team.gerb declares a parameter.
+func (s *Server) resolveDashboard(dashboardpath string) (string, []string) {
+	if _, ok := s.findDashboard(dashboardpath); ok {
+		return dashboardpath, nil
+	}
+
+	parts := strings.Split(dashboardpath, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		candidate := strings.Join(parts[:i], "/")
+		if _, ok := s.findDashboard(candidate); !ok {
+			continue
+		}
+		if len(s.getDashboardMeta(candidate).Params) >= len(parts)-i {
+			return candidate, parts[i:]
+		}
+	}
+	return dashboardpath, nil
+}
+
+// paramsContext adds the parameters to a render context, each by its name
+// unless the context already has it, and all of them as "params".
+func paramsContext(context map[string]interface{}, params map[string]string) map[string]interface{} {
+	for name, value := range params {
+		if _, ok := context[name]; !ok {
+			context[name] = value
+		}
+	}
+	context["params"] = params
+	return context
+}
+
+// expandDashboard renders the body of a dashboard of a format with its
+// parameters and the helpers, the content of its widgets markup being final.
+func (s *Server) expandDashboard(body string, ext string, params map[string]string) (string, error) {
+	if ext == ".tmpl" {
+		return expandHTMLDashboard(body, s.withHelpers(paramsContext(map[string]interface{}{}, params)))
+	}
+
+	template, err := gerb.ParseString(true, body)
+	if err != nil {
+		return "", err
+	}
+
+	// Rendered without the context of a request, the values it leaves
+	// undefined are not errors
+	errors := []string{}
+	defer gerbLog.collect(&errors)()
+
+	var out bytes.Buffer
+	template.Render(&out, s.withHelpers(paramsContext(map[string]interface{}{}, params)))
+	return out.String(), nil
+}
+
+// maxDashboardVariants is the number of variants of a dashboard read at most,
+// beyond which the combinations of its parameters are ignored.
+const maxDashboardVariants = 100
+
+// DashboardVariants returns the body of a dashboard file of a webroot, given
+// relative to the dashboards folders, expanded with each combination of the
+// accepted values of its parameters, partials and helpers being rendered too.
+// A dashboard which can not be expanded is returned as is.
+func DashboardVariants(webroot string, name string) ([]string, error) {
+	return serverOf(webroot).dashboardVariants(name)
+}
+
+// dashboardVariants returns the body of a dashboard file of the asset layers
+// expanded with each combination of the accepted values of its parameters. A
+// parameter without values takes its default, else an empty value.
+func (s *Server) dashboardVariants(name string) ([]string, error) {
+	raw, _, err := s.assets().ReadFile("dashboards", name)
+	if err != nil {
+		return nil, err
+	}
+	content := string(raw)
+	ext := path.Ext(name)
+
+	meta, body, err := parseFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Params) == 0 {
+		expanded, err := s.expandDashboard(body, ext, nil)
+		if err != nil {
+			return []string{content}, nil
+		}
+		return []string{expanded}, nil
+	}
+
+	combinations := []map[string]string{{}}
+	for _, p := range meta.Params {
+		values := p.Values
+		if len(values) == 0 {
+			values = []string{p.Default}
+		}
+		next := []map[string]string{}
+		for _, c := range combinations {
+			for _, v := range values {
+				if len(next) == maxDashboardVariants {
+					break
+				}
+				params := map[string]string{p.Name: v}
+				for name, value := range c {
+					params[name] = value
+				}
+				next = append(next, params)
+			}
+		}
+		if len(next) < len(combinations)*len(values) {
+			log.Printf("Params : dashboards/%s has more than %d variants, the next ones are ignored", name, maxDashboardVariants)
+		}
+		combinations = next
+	}
+
+	variants := []string{}
+	for _, params := range combinations {
+		variant, err := s.expandDashboard(body, ext, params)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
@@ -0,0 +1,130 @@
+package dashing
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParamValues(t *testing.T) {
+	meta := DashboardMeta{Params: []DashboardParam{
+		{Name: "team", Values: []string{"payments", "risk"}},
+		{Name: "env", Default: "prod"},
+	}}
+
+	tests := []struct {
+		name   string
+		values []string
+		query  string
+		params map[string]string
+		err    string
+	}{
+		{"path", []string{"risk", "dev"}, "", map[string]string{"team": "risk", "env": "dev"}, ""},
+		{"default", []string{"risk"}, "", map[string]string{"team": "risk", "env": "prod"}, ""},
+		{"query", nil, "team=payments&env=dev", map[string]string{"team": "payments", "env": "dev"}, ""},
+		{"path wins over the query", []string{"risk"}, "team=payments", map[string]string{"team": "risk", "env": "prod"}, ""},
+		{"missing", nil, "env=dev", nil, "missing parameter team"},
+		{"not accepted", []string{"hr"}, "", nil, "invalid value hr for parameter team"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		params, err := meta.paramValues(tt.values, query)
+		if err == nil && tt.err != "" || err != nil && err.Error() != tt.err {
+			t.Errorf("%s : error %v, want %q", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err == "" && !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("%s : params %v, want %v", tt.name, params, tt.params)
+		}
+	}
+}
+
+func TestResolveDashboard(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/team.gerb":          "+++\n[[param]]\nname = \"team\"\n[[param]]\nname = \"env\"\ndefault = \"prod\"\n+++\n<div data-id=\"<%= team %>-<%= env %>\"></div>",
+		"dashboards/team/payments.gerb": `<div data-id="payments"></div>`,
+		"dashboards/plain.gerb":         `<div></div>`,
+	})
+	defer cleanup()
+
+	tests := []struct {
+		path      string
+		dashboard string
+		values    []string
+	}{
+		{"team", "team", nil},
+		{"team/risk", "team", []string{"risk"}},
+		{"team/risk/dev", "team", []string{"risk", "dev"}},
+		{"team/risk/dev/x", "team/risk/dev/x", nil},
+		{"team/payments", "team/payments", nil},
+		{"plain/x", "plain/x", nil},
+	}
+	for _, tt := range tests {
+		dashboard, values := s.resolveDashboard(tt.path)
+		if dashboard != tt.dashboard || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("resolveDashboard(%s) = %s, %v, want %s, %v", tt.path, dashboard, values, tt.dashboard, tt.values)
+		}
+	}
+
+	router := s.NewRouter()
+	pages := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/team/risk", 200, `data-id="risk-prod"`},
+		{"/team/risk/dev", 200, `data-id="risk-dev"`},
+		{"/team?team=risk&env=dev", 200, `data-id="risk-dev"`},
+		{"/team/payments", 200, `data-id="payments"`},
+		{"/team", 404, ""},
+	}
+	for _, tt := range pages {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.url, w.Code, tt.status)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s : %q, want %q", tt.url, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestDashboardVariants(t *testing.T) {
+	values := func(n int) string {
+		v := []string{}
+		for i := 0; i < n; i++ {
+			v = append(v, fmt.Sprintf("%q", fmt.Sprint(i)))
+		}
+		return "[" + strings.Join(v, ", ") + "]"
+	}
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/plain.gerb": `<div data-id="<%= env %>"></div>`,
+		"dashboards/team.gerb":  "+++\n[[param]]\nname = \"team\"\nvalues = [\"a\", \"b\"]\n[[param]]\nname = \"env\"\ndefault = \"prod\"\n+++\n<div data-id=\"<%= team %>-<%= env %>\"></div>",
+		"dashboards/many.gerb":  "+++\n[[param]]\nname = \"x\"\nvalues = " + values(11) + "\n[[param]]\nname = \"y\"\nvalues = " + values(11) + "\n+++\n<div data-id=\"<%= x %>-<%= y %>\"></div>",
+	})
+	defer cleanup()
+
+	variants, err := s.dashboardVariants("plain.gerb")
+	if err != nil || !reflect.DeepEqual(variants, []string{`<div data-id=""></div>`}) {
+		t.Errorf("plain : variants %q, %v, want the dashboard expanded once", variants, err)
+	}
+
+	variants, err = s.dashboardVariants("team.gerb")
+	want := []string{"\n" + `<div data-id="a-prod"></div>`, "\n" + `<div data-id="b-prod"></div>`}
+	if err != nil || !reflect.DeepEqual(variants, want) {
+		t.Errorf("team : variants %q, %v, want %q", variants, err, want)
+	}
+
+	variants, err = s.dashboardVariants("many.gerb")
+	if err != nil || len(variants) != maxDashboardVariants {
+		t.Fatalf("many : %d variants, %v, want %d", len(variants), err, maxDashboardVariants)
+	}
+	if first, last := variants[0], variants[len(variants)-1]; !strings.Contains(first, `"0-0"`) || !strings.Contains(last, `"9-0"`) {
+		t.Errorf("many : variants from %q to %q, want from 0-0 to 9-0", first, last)
+	}
+}
@@ -0,0 +1,212 @@
+package dashing
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultDuration is the number of seconds a dashboard is displayed before
+// switching to the next one.
+const defaultDuration = 20
+
+// A Playlist is an ordered list of dashboards screens can follow, read from
+// a playlists/NAME.toml file.
+type Playlist struct {
+	Name    string
+	Entries []PlaylistEntry `toml:"dashboard"`
+	Rules   *RotationRules
+}
+
+// A PlaylistEntry is a dashboard of a playlist, displayed for Duration
+// seconds, optionally only between From and To (15:04 format) and on some
+// Days (mon, tue, ...).
+type PlaylistEntry struct {
+	Dashboard string `toml:"name"`
+	Duration  int
+	From      string
+	To        string
+	Days      []string
+}
+
+func (s *Server) getPlaylist(name string) (*Playlist, error) {
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid playlist name %s", name)
+	}
+
+	p := &Playlist{Name: name}
+	if _, err := toml.DecodeFile(s.webroot+"playlists/"+name+".toml", p); err != nil {
+		return nil, err
+	}
+	entries := []PlaylistEntry{}
+	for _, e := range p.Entries {
+		e.Dashboard = strings.Trim(e.Dashboard, "/")
+		if e.Duration <= 0 {
+			e.Duration = defaultDuration
+		}
+		_, errFrom := clock(e.From)
+		_, errTo := clock(e.To)
+		if errFrom != nil || errTo != nil {
+			log.Printf("Playlist : %s : ignoring %s, from and to are 15:04 times", name, e.Dashboard)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	p.Entries = entries
+	return p, nil
+}
+
+// clock returns the minutes since midnight of a 15:04 time, -1 when it is
+// empty.
+func clock(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active tells whether the entry should be displayed at the given time.
+func (e PlaylistEntry) Active(t time.Time) bool {
+	if len(e.Days) > 0 {
+		day := strings.ToLower(t.Weekday().String()[:3])
+		found := false
+		for _, d := range e.Days {
+			if strings.ToLower(d) == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	from, err := clock(e.From)
+	if err != nil {
+		return false
+	}
+	to, err := clock(e.To)
+	if err != nil {
+		return false
+	}
+	switch {
+	case from < 0 && to < 0:
+		return true
+	case to < 0:
+		return now >= from
+	case from < 0:
+		return now < to
+	case from <= to:
+		return now >= from && now < to
+	default:
+		// window spanning midnight
+		return now >= from || now < to
+	}
+}
+
+// Current returns the entry of the dashboard being displayed.
+func (p *Playlist) Current(dashboard string) (PlaylistEntry, bool) {
+	for _, e := range p.Entries {
+		if e.Dashboard == dashboard {
+			return e, true
+		}
+	}
+	return PlaylistEntry{}, false
+}
+
+// Upcoming returns the active entries following the given dashboard, in
+// rotation order, starting from the first entry when the dashboard is not
+// part of the playlist.
+func (p *Playlist) Upcoming(dashboard string, t time.Time) []PlaylistEntry {
+	position := -1
+	for i, e := range p.Entries {
+		if e.Dashboard == dashboard {
+			position = i
+			break
+		}
+	}
+
+	entries := []PlaylistEntry{}
+	for i := 1; i <= len(p.Entries); i++ {
+		e := p.Entries[(position+i)%len(p.Entries)]
+		if e.Active(t) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Next returns the active entry following the given dashboard.
+func (p *Playlist) Next(dashboard string, t time.Time) (PlaylistEntry, bool) {
+	entries := p.Upcoming(dashboard, t)
+	if len(entries) == 0 {
+		return PlaylistEntry{}, false
+	}
+	return entries[0], true
+}
+
+// getNextPlaylistEntry returns the entry to display after the given
+// dashboard, according to the rotation rules of the playlist.
+func (s *Server) getNextPlaylistEntry(p *Playlist, dashboard string) (PlaylistEntry, bool) {
+	entries := p.Upcoming(dashboard, time.Now())
+	if len(entries) == 0 {
+		return PlaylistEntry{}, false
+	}
+
+	rules := p.Rules
+	if rules == nil {
+		rules = s.getRotationRules()
+	}
+
+	candidates := []string{}
+	for _, e := range entries {
+		candidates = append(candidates, e.Dashboard)
+	}
+	next := s.rotate(rules, dashboard, candidates)
+
+	if next == dashboard {
+		if current, ok := p.Current(dashboard); ok {
+			return current, true
+		}
+	}
+	for _, e := range entries {
+		if e.Dashboard == next {
+			return e, true
+		}
+	}
+	return entries[0], true
+}
+
+// URL returns the url displaying the entry as part of the playlist.
+func (p *Playlist) URL(e PlaylistEntry) string {
+	return e.Dashboard + "?playlist=" + url.QueryEscape(p.Name)
+}
+
+// PlaylistHandler redirects to the first active dashboard of a playlist.
+func (s *Server) PlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	playlist, err := s.getPlaylist(param(r, "name"))
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "playlists", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, ok := playlist.Next("", time.Now())
+	if !ok {
+		log.Printf("404 - %s - no active dashboard in %s\n", "playlists", playlist.Name)
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, s.prefix+"/"+playlist.URL(entry), http.StatusTemporaryRedirect)
+}
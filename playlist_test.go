@@ -0,0 +1,89 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlaylistEntryActive(t *testing.T) {
+	// 2017-01-02 is a monday
+	at := func(clock string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", "2017-01-02 "+clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name  string
+		entry PlaylistEntry
+		at    string
+		want  bool
+	}{
+		{"no window", PlaylistEntry{}, "03:00", true},
+		{"from only, before", PlaylistEntry{From: "08:00"}, "07:59", false},
+		{"from only, at", PlaylistEntry{From: "08:00"}, "08:00", true},
+		{"to only, before", PlaylistEntry{To: "18:00"}, "17:59", true},
+		{"to only, at", PlaylistEntry{To: "18:00"}, "18:00", false},
+		{"window, inside", PlaylistEntry{From: "08:00", To: "18:00"}, "12:00", true},
+		{"window, after", PlaylistEntry{From: "08:00", To: "18:00"}, "19:00", false},
+		{"single digit hour", PlaylistEntry{From: "9:00", To: "10:00"}, "9:30", true},
+		{"single digit hour, before", PlaylistEntry{From: "9:00", To: "10:00"}, "08:30", false},
+		{"over midnight, evening", PlaylistEntry{From: "22:00", To: "06:00"}, "23:00", true},
+		{"over midnight, morning", PlaylistEntry{From: "22:00", To: "06:00"}, "05:59", true},
+		{"over midnight, day", PlaylistEntry{From: "22:00", To: "06:00"}, "12:00", false},
+		{"day matches", PlaylistEntry{Days: []string{"Mon", "tue"}}, "12:00", true},
+		{"day does not match", PlaylistEntry{Days: []string{"sat", "sun"}}, "12:00", false},
+		{"invalid time", PlaylistEntry{From: "8h"}, "12:00", false},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.Active(at(tt.at)); got != tt.want {
+			t.Errorf("%s : Active(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestGetPlaylistIgnoresInvalidWindows(t *testing.T) {
+	webroot, err := ioutil.TempDir("", "playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(webroot)
+	os.MkdirAll(filepath.Join(webroot, "playlists"), 0755)
+	ioutil.WriteFile(filepath.Join(webroot, "playlists", "lobby.toml"), []byte(`
+[[dashboard]]
+name = "/sales/"
+[[dashboard]]
+name = "ops"
+from = "25:00"
+[[dashboard]]
+name = "night"
+from = "22:00"
+to = "6:00"
+duration = 60
+`), 0644)
+
+	s := NewServer(nil)
+	s.webroot = webroot + string(filepath.Separator)
+	p, err := s.getPlaylist("lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PlaylistEntry{
+		{Dashboard: "sales", Duration: defaultDuration},
+		{Dashboard: "night", Duration: 60, From: "22:00", To: "6:00"},
+	}
+	if len(p.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(p.Entries), len(want))
+	}
+	for i, e := range p.Entries {
+		if e.Dashboard != want[i].Dashboard || e.Duration != want[i].Duration || e.From != want[i].From || e.To != want[i].To {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package dashing
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// reloadTarget returns the dashboard to reload when a file changes in
+// development mode, "*" for all of them, or an empty string when no
+// dashboard is affected. The file is in the webroot, or in another asset
+// layer.
+func (s *Server) reloadTarget(file string) string {
+	// The deepest layer wins, as a layer may be a folder of the webroot
+	rel, depth := "", -1
+	for _, l := range s.assets().Layers {
+		if r, err := filepath.Rel(l.Path, file); l.Path != "" && err == nil && !strings.HasPrefix(r, "..") && len(l.Path) > depth {
+			rel, depth = filepath.ToSlash(r), len(l.Path)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(rel, "public/uploads/"):
+		// Uploaded files are shown through the data of the widgets
+		return ""
+	case strings.HasPrefix(rel, "widgets/"), strings.HasPrefix(rel, "public/"), strings.HasPrefix(rel, "partials/"),
+		strings.HasPrefix(rel, "layouts/"), strings.HasPrefix(rel, "themes/"):
+		return "*"
+	case strings.HasPrefix(rel, "dashboards/") && filepath.Base(rel) == "folder.toml":
+		return "*"
+	case strings.HasPrefix(rel, "dashboards/") && IsDashboardFile(rel):
+		dashboardpath := strings.TrimSuffix(strings.TrimPrefix(rel, "dashboards/"), filepath.Ext(rel))
+		if filepath.Base(dashboardpath) == "layout" {
+			return "*"
+		}
+		return dashboardpath
+	}
+	return ""
+}
+
+// reload asks the clients viewing the given dashboards to reload.
+func (s *Server) reload(dashboards map[string]bool) {
+	if dashboards["*"] {
+		dashboards = map[string]bool{"*": true}
+	}
+	for dashboard := range dashboards {
+		s.broker.events <- NewEvent("reload", map[string]interface{}{
+			"dashboard": dashboard,
+			"event":     "reload",
+		}, "dashboards")
+	}
+}
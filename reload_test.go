@@ -0,0 +1,108 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadTarget(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"conf/assets.toml": "[[layer]]\nname = \"team\"\npath = \"team\"\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"dashboards/sample.gerb", "sample"},
+		{"dashboards/ops/paris.gerb", "ops/paris"},
+		{"dashboards/layout.gerb", "*"},
+		{"dashboards/ops/layout.gerb", "*"},
+		{"dashboards/ops/folder.toml", "*"},
+		{"dashboards/notes.txt", ""},
+		{"widgets/number/number.js", "*"},
+		{"public/css/app.css", "*"},
+		{"public/uploads/logo.png", ""},
+		{"partials/header.gerb", "*"},
+		{"layouts/tv.gerb", "*"},
+		{"themes/dark.css", "*"},
+		{"conf/rotation.toml", ""},
+		{"team/dashboards/ops.gerb", "ops"},
+		{"team/widgets/graph/graph.js", "*"},
+	}
+	for _, tt := range tests {
+		if got := s.reloadTarget(filepath.Join(s.webroot, tt.file)); got != tt.want {
+			t.Errorf("reloadTarget(%s) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+	if got := s.reloadTarget("/elsewhere/dashboards/sample.gerb"); got != "" {
+		t.Errorf("reloadTarget of a file out of the layers = %q, want nothing", got)
+	}
+}
+
+func TestWatchReloads(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/a.gerb":             `<div></div>`,
+		"dashboards/b.gerb":             `<div></div>`,
+		"widgets/number/number.html":    `<div></div>`,
+		"public/uploads/logo.png":       "png",
+		"dashboards/ops/folder.toml":    "",
+		"dashboards/ops/unchanged.gerb": `<div></div>`,
+	})
+	defer cleanup()
+	s.dev = true
+	s.broker = NewBroker()
+	s.broker.events = make(chan *Event, 100)
+	s.watch()
+
+	// reloads returns the dashboards asked to reload once the changes settle
+	reloads := func() string {
+		dashboards := []string{}
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case e := <-s.broker.events:
+				if e.ID != "reload" || e.Target != "dashboards" {
+					t.Errorf("event %s of target %s, want a reload of the dashboards", e.ID, e.Target)
+				}
+				dashboards = append(dashboards, e.Body["dashboard"].(string))
+				timeout = time.After(500 * time.Millisecond)
+			case <-timeout:
+				sort.Strings(dashboards)
+				return strings.Join(dashboards, " ")
+			}
+		}
+	}
+	write := func(files ...string) {
+		for _, file := range files {
+			if err := ioutil.WriteFile(filepath.Join(s.webroot, file), []byte("<div>changed</div>"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	write("dashboards/a.gerb", "dashboards/a.gerb", "dashboards/b.gerb")
+	if got, want := reloads(), "a b"; got != want {
+		t.Errorf("dashboards changed : reloads %q, want %q", got, want)
+	}
+	write("dashboards/a.gerb", "widgets/number/number.html")
+	if got, want := reloads(), "*"; got != want {
+		t.Errorf("widget changed : reloads %q, want %q", got, want)
+	}
+	write("public/uploads/logo.png")
+	if got, want := reloads(), ""; got != want {
+		t.Errorf("upload changed : reloads %q, want %q", got, want)
+	}
+	writeFiles(t, s.webroot, map[string]string{"dashboards/ops/new/c.gerb": `<div></div>`})
+	time.Sleep(100 * time.Millisecond)
+	reloads()
+	write("dashboards/ops/new/c.gerb")
+	if got, want := reloads(), "ops/new/c"; got != want {
+		t.Errorf("dashboard of a new folder changed : reloads %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package dashing
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// RotationRules change the dashboards rotation according to the status of
+// their widgets. They are read from conf/rotation.toml, or from the [rules]
+// table of a playlist.
+type RotationRules struct {
+	// Stay on the current dashboard while one of its widgets has one of
+	// these statuses.
+	Pin []string
+	// Only rotate between the dashboards having a widget with one of these
+	// statuses, when there are some.
+	Jump []string
+	// Skip the dashboards where all widgets are in normal status.
+	SkipNormal bool `toml:"skip_normal"`
+	// Skip the dashboards where no widget was updated for this number of
+	// seconds.
+	SkipUnchanged int `toml:"skip_unchanged"`
+}
+
+// getRotationRules returns the rotation rules of conf/rotation.toml.
+func (s *Server) getRotationRules() *RotationRules {
+	v, _ := s.fromCache("rotation", func() (interface{}, error) {
+		rules := &RotationRules{}
+		if _, err := os.Stat(s.webroot + "conf/rotation.toml"); err != nil {
+			return rules, nil
+		}
+		if _, err := toml.DecodeFile(s.webroot+"conf/rotation.toml", rules); err != nil {
+			log.Printf("Rotation : can not read config file %s : %s", "conf/rotation.toml", err)
+		}
+		return rules, nil
+	})
+	return v.(*RotationRules)
+}
+
+var widgetIDRegex = regexp.MustCompile(`data-id\s*=\s*["']([^"']+)["']`)
+
+// getDashboardWidgetIDs returns the ID of each widget of a dashboard, as
+// expanded with its parameters.
+func (s *Server) getDashboardWidgetIDs(dashboardpath string) []string {
+	v, _ := s.fromCache("ids:"+dashboardpath, func() (interface{}, error) {
+		ids := []string{}
+		file, values := s.resolveDashboard(dashboardpath)
+		ext := s.dashboardExt(file)
+		content, _, err := s.assets().ReadFile("dashboards", file+ext)
+		if err != nil {
+			return ids, nil
+		}
+
+		if meta, body, err := parseFrontMatter(string(content)); err == nil && len(meta.Params) > 0 {
+			params, err := meta.paramValues(values, nil)
+			if err != nil {
+				return ids, nil
+			}
+			expanded, err := s.expandDashboard(body, ext, params)
+			if err != nil {
+				return ids, nil
+			}
+			content = []byte(expanded)
+		}
+
+		for _, m := range widgetIDRegex.FindAllSubmatch(content, -1) {
+			ids = append(ids, string(m[1]))
+		}
+		return ids, nil
+	})
+	return v.([]string)
+}
+
+// hasStatus tells whether one of the dashboard widgets has one of statuses.
+func (s *Server) hasStatus(dashboardpath string, statuses []string) bool {
+	if len(statuses) == 0 {
+		return false
+	}
+	namespace := s.getNamespace(dashboardpath)
+	for _, id := range s.getDashboardWidgetIDs(dashboardpath) {
+		if e, ok := s.broker.cached(namespace, id); ok && stringInSlice(eventStatus(e), statuses) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped tells whether the rules exclude a dashboard from the rotation.
+func (s *Server) skipped(rules *RotationRules, dashboardpath string) bool {
+	if !rules.SkipNormal && rules.SkipUnchanged <= 0 {
+		return false
+	}
+
+	normal, unchanged := true, true
+	since := time.Now().Add(-time.Duration(rules.SkipUnchanged) * time.Second).Unix()
+	namespace := s.getNamespace(dashboardpath)
+	for _, id := range s.getDashboardWidgetIDs(dashboardpath) {
+		e, ok := s.broker.cached(namespace, id)
+		if !ok {
+			continue
+		}
+		if eventStatus(e) != "normal" {
+			normal = false
+		}
+		if eventUpdatedAt(e) >= since {
+			unchanged = false
+		}
+	}
+
+	return (rules.SkipNormal && normal) || (rules.SkipUnchanged > 0 && unchanged)
+}
+
+// rotate returns the dashboard to display after current, candidates being
+// the dashboards following it in the rotation order.
+func (s *Server) rotate(rules *RotationRules, current string, candidates []string) string {
+	if s.hasStatus(current, rules.Pin) {
+		return current
+	}
+
+	if len(rules.Jump) > 0 {
+		for _, c := range candidates {
+			if s.hasStatus(c, rules.Jump) {
+				return c
+			}
+		}
+		// The current dashboard is the only one with these statuses
+		if s.hasStatus(current, rules.Jump) {
+			return current
+		}
+	}
+
+	for _, c := range candidates {
+		if !s.skipped(rules, c) {
+			return c
+		}
+	}
+
+	// Every dashboard is skipped, rotate as usual.
+	return candidates[0]
+}
+
+func eventStatus(e *Event) string {
+	if status, ok := e.Body["status"].(string); ok && status != "" {
+		return status
+	}
+	return "normal"
+}
+
+func eventUpdatedAt(e *Event) int64 {
+	switch updatedAt := e.Body["updatedAt"].(type) {
+	case int32:
+		return int64(updatedAt)
+	case int64:
+		return updatedAt
+	case float64:
+		return int64(updatedAt)
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package dashing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotationRules(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/a.gerb":          `<div data-id="a1"></div><div data-id="a2"></div>`,
+		"dashboards/b.gerb":          `<div data-id="b1"></div>`,
+		"dashboards/c.gerb":          `<div data-id="c1"></div>`,
+		"dashboards/d.gerb":          `<div data-id="d1"></div>`,
+		"dashboards/ops/folder.toml": "namespace = \"ops\"\n",
+		"dashboards/ops/x.gerb":      `<div data-id="b1"></div>`,
+		"dashboards/ops/y.gerb":      `<div data-id="c1"></div>`,
+	})
+	defer cleanup()
+	s.broker = NewBroker()
+
+	old := time.Now().Add(-time.Hour).Unix()
+	status := func(namespace string, statuses map[string]string) {
+		s.broker.cache = map[string]*Event{}
+		for id, st := range statuses {
+			updatedAt := time.Now().Unix()
+			if st == "old" {
+				st, updatedAt = "normal", old
+			}
+			e := &Event{ID: id, Namespace: namespace, Body: map[string]interface{}{"status": st, "updatedAt": float64(updatedAt)}}
+			s.broker.cache[namespacedID(namespace, id)] = e
+		}
+	}
+
+	tests := []struct {
+		name      string
+		rules     RotationRules
+		namespace string
+		statuses  map[string]string
+		current   string
+		next      string
+	}{
+		{"no rules", RotationRules{}, "", map[string]string{"c1": "danger"}, "a", "b"},
+		{"last one", RotationRules{}, "", nil, "d", "a"},
+		{"pin", RotationRules{Pin: []string{"danger"}}, "", map[string]string{"a2": "danger"}, "a", "a"},
+		{"pin other status", RotationRules{Pin: []string{"danger"}}, "", map[string]string{"a2": "warning"}, "a", "b"},
+		{"jump", RotationRules{Jump: []string{"danger", "warning"}}, "", map[string]string{"c1": "warning"}, "a", "c"},
+		{"jump to the first following", RotationRules{Jump: []string{"danger"}}, "", map[string]string{"a1": "danger", "b1": "danger", "d1": "danger"}, "b", "d"},
+		{"stay on the only jumping one", RotationRules{Jump: []string{"danger"}}, "", map[string]string{"b1": "danger"}, "b", "b"},
+		{"jump without status", RotationRules{Jump: []string{"danger"}}, "", nil, "a", "b"},
+		{"skip normal", RotationRules{SkipNormal: true}, "", map[string]string{"b1": "normal", "c1": "normal", "d1": "warning"}, "a", "d"},
+		{"skip unchanged", RotationRules{SkipUnchanged: 60}, "", map[string]string{"b1": "old", "c1": "normal"}, "a", "c"},
+		{"every dashboard skipped", RotationRules{SkipNormal: true}, "", map[string]string{"a1": "normal", "b1": "normal", "c1": "normal", "d1": "normal"}, "a", "b"},
+		{"namespaced statuses", RotationRules{Jump: []string{"danger"}}, "ops", map[string]string{"c1": "danger"}, "a", "b"},
+		{"statuses of the namespace", RotationRules{Jump: []string{"danger"}}, "ops", map[string]string{"c1": "danger"}, "ops/x", "ops/y"},
+	}
+	for _, tt := range tests {
+		status(tt.namespace, tt.statuses)
+		rules := tt.rules
+		s.cache.set("rotation", &rules, s.cache.current())
+		_, next := s.getNextDashboardName(tt.current)
+		if next != tt.next {
+			t.Errorf("%s : next of %s is %s, want %s", tt.name, tt.current, next, tt.next)
+		}
+	}
+}
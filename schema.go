@@ -0,0 +1,363 @@
+package dashing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// The handlings of the widget data not matching the schema of their widget.
+const (
+	ValidationStrict = "strict"
+	ValidationWarn   = "warn"
+	ValidationOff    = "off"
+)
+
+// ValidationMode returns the handling of the widget data not matching the
+// schema of their widget, set by the WIDGET_VALIDATION env var : warn, the
+// default, only logs them, strict rejects them, off does not validate them.
+func ValidationMode() string {
+	switch mode := os.Getenv("WIDGET_VALIDATION"); mode {
+	case ValidationStrict, ValidationOff:
+		return mode
+	}
+	return ValidationWarn
+}
+
+// A jsonSchema is the subset of JSON Schema describing the data of a widget.
+type jsonSchema struct {
+	// Type is a type name, or a list of them
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Pattern              string                 `json:"pattern"`
+}
+
+// A FieldError is a field of widget data not matching the schema of a
+// widget.
+type FieldError struct {
+	Widget  string `json:"widget"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s : %s %s", e.Widget, e.Field, e.Message)
+}
+
+// joinFieldErrors returns the field errors on a line.
+func joinFieldErrors(errs []FieldError) string {
+	messages := []string{}
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// types returns the type names allowed by a schema, none for any.
+func (sc *jsonSchema) types() []string {
+	switch t := sc.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// jsonType returns the JSON type name of a decoded value.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validate returns the errors of a decoded value of a field.
+func (sc *jsonSchema) validate(field string, v interface{}) []FieldError {
+	fail := func(format string, a ...interface{}) []FieldError {
+		return []FieldError{{Field: field, Message: fmt.Sprintf(format, a...)}}
+	}
+
+	if types := sc.types(); len(types) > 0 {
+		t := jsonType(v)
+		if !stringInSlice(t, types) && !(t == "integer" && stringInSlice("number", types)) {
+			if t == "integer" {
+				t = "number"
+			}
+			article := "a"
+			if strings.IndexByte("aeiou", t[0]) != -1 {
+				article = "an"
+			}
+			return fail("is %s %s, expected %s", article, t, strings.Join(types, " or "))
+		}
+	}
+
+	if len(sc.Enum) > 0 {
+		found := false
+		for _, e := range sc.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+			}
+		}
+		if !found {
+			return fail("is not one of the allowed values")
+		}
+	}
+
+	errs := []FieldError{}
+	switch v := v.(type) {
+	case float64:
+		if sc.Minimum != nil && v < *sc.Minimum {
+			return fail("is lower than %v", *sc.Minimum)
+		}
+		if sc.Maximum != nil && v > *sc.Maximum {
+			return fail("is greater than %v", *sc.Maximum)
+		}
+	case string:
+		if sc.MinLength != nil && len([]rune(v)) < *sc.MinLength {
+			return fail("is shorter than %d characters", *sc.MinLength)
+		}
+		if sc.MaxLength != nil && len([]rune(v)) > *sc.MaxLength {
+			return fail("is longer than %d characters", *sc.MaxLength)
+		}
+		if sc.Pattern != "" {
+			if re, err := regexp.Compile(sc.Pattern); err == nil && !re.MatchString(v) {
+				return fail("does not match %s", sc.Pattern)
+			}
+		}
+	case []interface{}:
+		if sc.MinItems != nil && len(v) < *sc.MinItems {
+			return fail("has less than %d items", *sc.MinItems)
+		}
+		if sc.MaxItems != nil && len(v) > *sc.MaxItems {
+			return fail("has more than %d items", *sc.MaxItems)
+		}
+		if sc.Items != nil {
+			for i, item := range v {
+				errs = append(errs, sc.Items.validate(fmt.Sprintf("%s[%d]", field, i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		prefix := field + "."
+		if field == "" {
+			prefix = ""
+		}
+		for _, name := range sc.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, FieldError{Field: prefix + name, Message: "is required"})
+			}
+		}
+		names := []string{}
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := v[name]
+			if p, ok := sc.Properties[name]; ok {
+				errs = append(errs, p.validate(prefix+name, value)...)
+			} else if sc.AdditionalProperties != nil && !*sc.AdditionalProperties {
+				errs = append(errs, FieldError{Field: prefix + name, Message: "is not allowed"})
+			}
+		}
+	}
+	return errs
+}
+
+// manifestSchema returns the schema of the fields of a widget manifest, nil
+// when it declares none.
+func manifestSchema(m *WidgetManifest) *jsonSchema {
+	if len(m.Fields) == 0 {
+		return nil
+	}
+	sc := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+	for _, f := range m.Fields {
+		sc.Properties[f.Name] = &jsonSchema{}
+		if f.Type != "" {
+			sc.Properties[f.Name].Type = f.Type
+		}
+		if f.Required {
+			sc.Required = append(sc.Required, f.Name)
+		}
+	}
+	return sc
+}
+
+// readWidgetSchema returns the schema of a widget, from the first asset layer
+// having it : its NAME.schema.json, or the fields of its widget.toml on disk.
+// It is nil when the widget has none.
+func readWidgetSchema(o *AssetOverlay, view string) *jsonSchema {
+	names := []string{}
+	for _, name := range []string{view, underscore(view), strings.ToLower(view), CamelCase(view)} {
+		if !stringInSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+
+	for _, l := range o.Layers {
+		for _, name := range names {
+			file := name + "/" + name + ".schema.json"
+			if content, err := l.readFile("widgets", file); err == nil {
+				var sc jsonSchema
+				if err := json.Unmarshal(content, &sc); err != nil {
+					log.Printf("Widgets : invalid schema %s : %s", l.location("widgets", file), err)
+					return nil
+				}
+				return &sc
+			}
+			if l.Path != "" {
+				dir := filepath.Join(l.Path, "widgets", name)
+				if _, err := os.Stat(filepath.Join(dir, widgetManifestFile)); err == nil {
+					if m, err := ReadWidgetManifest(dir); err == nil {
+						return manifestSchema(m)
+					}
+				}
+			}
+			// A widget of a layer overrides the next ones with its schema
+			if l.hasDir("widgets", name) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// WidgetSchemas validates the data pushed to the widget IDs of the
+// dashboards of a webroot, against the schemas of the widgets they are bound
+// to by data-view.
+type WidgetSchemas struct {
+	// views of each ID, in its namespace, and of each ID, in any namespace
+	views       map[string][]string
+	globalViews map[string][]string
+	schemas     map[string]*jsonSchema
+}
+
+// LoadWidgetSchemas reads the widgets bound to the IDs of the dashboards of a
+// webroot, and their schemas.
+func LoadWidgetSchemas(webroot string) *WidgetSchemas {
+	return serverOf(webroot).loadWidgetSchemas()
+}
+
+// loadWidgetSchemas reads the widgets bound to the IDs of the dashboards, and
+// their schemas.
+func (s *Server) loadWidgetSchemas() *WidgetSchemas {
+	o := s.assets()
+	ws := &WidgetSchemas{
+		views:       map[string][]string{},
+		globalViews: map[string][]string{},
+		schemas:     map[string]*jsonSchema{},
+	}
+
+	add := func(views map[string][]string, key string, view string) {
+		if !stringInSlice(view, views[key]) {
+			views[key] = append(views[key], view)
+		}
+	}
+	for _, file := range s.dashboardFiles() {
+		variants, err := s.dashboardVariants(file)
+		if err != nil {
+			continue
+		}
+		namespace := s.getNamespace(strings.TrimSuffix(file, path.Ext(file)))
+		for _, variant := range variants {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(variant))
+			if err != nil {
+				continue
+			}
+			doc.Find("[data-id][data-view]").Each(func(i int, sel *goquery.Selection) {
+				id, _ := sel.Attr("data-id")
+				view, _ := sel.Attr("data-view")
+				add(ws.views, namespacedID(namespace, id), view)
+				add(ws.globalViews, id, view)
+				if _, ok := ws.schemas[view]; !ok {
+					ws.schemas[view] = readWidgetSchema(o, view)
+				}
+			})
+		}
+	}
+	return ws
+}
+
+// Validate returns the errors of the data of a widget ID of a namespace,
+// against the schema of each widget bound to it. The data of a global ID is
+// checked against the widgets bound to it in any namespace, as they show it
+// until their namespace has data of its own.
+func (ws *WidgetSchemas) Validate(namespace string, id string, data map[string]interface{}) []FieldError {
+	views := ws.views[namespacedID(namespace, id)]
+	if namespace == "" {
+		views = ws.globalViews[id]
+	}
+
+	errs := []FieldError{}
+	for _, view := range views {
+		sc := ws.schemas[view]
+		if sc == nil {
+			continue
+		}
+		for _, e := range sc.validate("", data) {
+			e.Widget = view
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// widgetSchemas returns the schemas of the widgets of the dashboards. They
+// are cached in development mode too, as every event is checked against
+// them, until a file changes.
+func (s *Server) widgetSchemas() *WidgetSchemas {
+	v, _ := s.cache.fetch("schemas", func() (interface{}, error) {
+		return s.loadWidgetSchemas(), nil
+	})
+	return v.(*WidgetSchemas)
+}
+
+// WidgetSchemasOf returns the schemas of the widgets of the dashboards of a
+// webroot, for the jobs, cached by its server until a file changes.
+func WidgetSchemasOf(webroot string) *WidgetSchemas {
+	s, ok := runningServer(webroot)
+	if !ok {
+		return LoadWidgetSchemas(webroot)
+	}
+	return s.widgetSchemas()
+}
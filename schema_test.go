@@ -0,0 +1,120 @@
+package dashing
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fieldErrors returns the errors on a line, as their field and message.
+func fieldErrors(errs []FieldError) string {
+	messages := []string{}
+	for _, e := range errs {
+		messages = append(messages, strings.TrimSpace(e.Field+" "+e.Message))
+	}
+	return strings.Join(messages, ", ")
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		data   string
+		want   string
+	}{
+		{"any", `{}`, `{"a": 1}`, ""},
+		{"type", `{"type": "object", "properties": {"a": {"type": "string"}}}`, `{"a": 1}`, "a is a number, expected string"},
+		{"article", `{"properties": {"a": {"type": "string"}}}`, `{"a": [1]}`, "a is an array, expected string"},
+		{"integer is a number", `{"properties": {"a": {"type": "number"}}}`, `{"a": 2}`, ""},
+		{"number is not an integer", `{"properties": {"a": {"type": "integer"}}}`, `{"a": 2.5}`, "a is a number, expected integer"},
+		{"type list", `{"properties": {"a": {"type": ["string", "null"]}}}`, `{"a": null}`, ""},
+		{"required", `{"required": ["a", "b"]}`, `{"a": 1}`, "b is required"},
+		{"additional properties", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2}`, "b is not allowed"},
+		{"enum", `{"properties": {"status": {"enum": ["ok", "danger"]}}}`, `{"status": "warning"}`, "status is not one of the allowed values"},
+		{"minimum", `{"properties": {"a": {"minimum": 0}}}`, `{"a": -1}`, "a is lower than 0"},
+		{"maximum", `{"properties": {"a": {"maximum": 100}}}`, `{"a": 101}`, "a is greater than 100"},
+		{"min length", `{"properties": {"a": {"minLength": 2}}}`, `{"a": "é"}`, "a is shorter than 2 characters"},
+		{"max length in characters", `{"properties": {"a": {"maxLength": 2}}}`, `{"a": "éé"}`, ""},
+		{"pattern", `{"properties": {"a": {"pattern": "^#[0-9a-f]{6}$"}}}`, `{"a": "red"}`, "a does not match ^#[0-9a-f]{6}$"},
+		{"min items", `{"properties": {"a": {"minItems": 1}}}`, `{"a": []}`, "a has less than 1 items"},
+		{"max items", `{"properties": {"a": {"maxItems": 1}}}`, `{"a": [1, 2]}`, "a has more than 1 items"},
+		{
+			"items",
+			`{"properties": {"items": {"items": {"type": "object", "required": ["label"], "properties": {"value": {"type": "number"}}}}}}`,
+			`{"items": [{"label": "a", "value": 1}, {"value": "b"}]}`,
+			"items[1].label is required, items[1].value is a string, expected number",
+		},
+		{"sorted fields", `{"properties": {"a": {"type": "string"}, "b": {"type": "string"}}}`, `{"b": 1, "a": 1}`, "a is a number, expected string, b is a number, expected string"},
+	}
+	for _, tt := range tests {
+		var sc jsonSchema
+		if err := json.Unmarshal([]byte(tt.schema), &sc); err != nil {
+			t.Fatalf("%s : %s", tt.name, err)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+			t.Fatalf("%s : %s", tt.name, err)
+		}
+		if got := fieldErrors(sc.validate("", data)); got != tt.want {
+			t.Errorf("%s : %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWidgetSchemasValidate(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"widgets/Gauge/Gauge.html":        "<div></div>",
+		"widgets/Gauge/Gauge.schema.json": `{"type": "object", "properties": {"value": {"type": "number"}}}`,
+		"widgets/Dial/Dial.html":          "<div></div>",
+		"widgets/Dial/widget.toml":        "name = \"Dial\"\nversion = \"1.0.0\"\n[[field]]\nname = \"angle\"\ntype = \"integer\"\nrequired = true\n",
+		"dashboards/main.gerb":            `<div data-id="load" data-view="Gauge"></div><div data-id="free" data-view="Text"></div>`,
+		"dashboards/ops/folder.toml":      "namespace = \"ops\"\n",
+		"dashboards/ops/room.gerb":        `<div data-id="load" data-view="Dial"></div>`,
+	})
+	defer cleanup()
+	ws := s.loadWidgetSchemas()
+
+	tests := []struct {
+		name      string
+		namespace string
+		id        string
+		data      string
+		want      string
+	}{
+		{"valid", "", "load", `{"value": 1, "angle": 2}`, ""},
+		{"schema file", "ops", "load", `{"angle": "a"}`, "angle is a string, expected integer"},
+		{"manifest fields", "ops", "load", `{}`, "angle is required"},
+		{"global id checked against every namespace", "", "load", `{"value": "a", "angle": 1}`, "value is a string, expected number"},
+		{"namespaced id checked against its namespace", "ops", "load", `{"value": "a", "angle": 1}`, ""},
+		{"widget without schema", "", "free", `{"text": 1}`, ""},
+		{"unknown id", "", "nope", `{"value": "a"}`, ""},
+	}
+	for _, tt := range tests {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+			t.Fatalf("%s : %s", tt.name, err)
+		}
+		if got := fieldErrors(ws.Validate(tt.namespace, tt.id, data)); got != tt.want {
+			t.Errorf("%s : %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWidgetSchemasCache(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"widgets/Gauge/Gauge.html":        "<div></div>",
+		"widgets/Gauge/Gauge.schema.json": `{"type": "object", "properties": {"value": {"type": "number"}}}`,
+		"dashboards/main.gerb":            `<div data-id="load" data-view="Gauge"></div>`,
+	})
+	defer cleanup()
+	s.dev = true
+
+	ws := s.widgetSchemas()
+	if s.widgetSchemas() != ws {
+		t.Errorf("schemas built again in development mode")
+	}
+	s.cache.flush()
+	if s.widgetSchemas() == ws {
+		t.Errorf("schemas kept once the cache is flushed")
+	}
+}
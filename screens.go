@@ -0,0 +1,209 @@
+package dashing
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Screen describes a client of the events stream, as seen by the server.
+type Screen struct {
+	Name         string    `json:"name"`
+	RemoteAddr   string    `json:"remoteAddr"`
+	UserAgent    string    `json:"userAgent"`
+	Dashboard    string    `json:"dashboard"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	LastWrite    time.Time `json:"lastWrite"`
+	Online       bool      `json:"online"`
+	OfflineSince time.Time `json:"offlineSince"`
+	connections  int
+}
+
+// screenRetention is how long an offline screen stays in the registry.
+const screenRetention = 24 * time.Hour
+
+// screenWidgets are the IDs of the widgets of the built-in screens
+// dashboard, reserved to the server.
+var screenWidgets = []string{"_screens", "_screens_online", "_screens_offline"}
+
+// clientCookie names the cookie telling apart the unnamed screens, which
+// may share a remote host.
+const clientCookie = "dashing_client"
+
+// A screenRegistry keeps track of connected and disconnected screens.
+type screenRegistry struct {
+	sync.RWMutex
+	screens map[string]*Screen
+}
+
+func newScreenRegistry() *screenRegistry {
+	return &screenRegistry{
+		screens: map[string]*Screen{},
+	}
+}
+
+// key identifies the screen of a client : its name when it has one, its
+// client cookie otherwise.
+func (c *client) key() string {
+	if c.screen != "" {
+		return c.screen
+	}
+	return clientCookie + ":" + c.id
+}
+
+// name returns the name of the screen of a client, its remote host and the
+// start of its client cookie when it has none.
+func (c *client) name() string {
+	if c.screen != "" {
+		return c.screen
+	}
+	host, _, err := net.SplitHostPort(c.remoteAddr)
+	if err != nil {
+		host = c.remoteAddr
+	}
+	return host + " #" + c.id[:6]
+}
+
+// clientID returns the client cookie of a request, setting a new one when
+// it has none.
+func clientID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(clientCookie); err == nil && len(cookie.Value) >= 6 {
+		return cookie.Value
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := fmt.Sprintf("%x", b)
+	http.SetCookie(w, &http.Cookie{Name: clientCookie, Value: id, Path: "/", MaxAge: 10 * 365 * 24 * 3600, HttpOnly: true})
+	return id
+}
+
+func (sr *screenRegistry) connect(c *client) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	now := time.Now()
+	screen, ok := sr.screens[c.key()]
+	if !ok {
+		screen = &Screen{Name: c.name()}
+		sr.screens[c.key()] = screen
+	}
+	if screen.connections == 0 {
+		screen.ConnectedAt = now
+	}
+	screen.connections++
+	screen.RemoteAddr = c.remoteAddr
+	screen.UserAgent = c.userAgent
+	screen.Dashboard = c.dashboard
+	screen.LastWrite = now
+	screen.Online = true
+	screen.OfflineSince = time.Time{}
+}
+
+func (sr *screenRegistry) disconnect(c *client) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	screen, ok := sr.screens[c.key()]
+	if !ok {
+		return
+	}
+	screen.connections--
+	if screen.connections <= 0 {
+		screen.connections = 0
+		screen.Online = false
+		screen.OfflineSince = time.Now()
+	}
+}
+
+// seen records a successful write to the client.
+func (sr *screenRegistry) seen(c *client) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	if screen, ok := sr.screens[c.key()]; ok {
+		screen.LastWrite = time.Now()
+	}
+}
+
+// expire removes the screens offline for longer than the retention.
+func (sr *screenRegistry) expire(now time.Time) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	for key, screen := range sr.screens {
+		if !screen.Online && now.Sub(screen.OfflineSince) > screenRetention {
+			delete(sr.screens, key)
+		}
+	}
+}
+
+// list returns a copy of the registered screens, online ones first.
+func (sr *screenRegistry) list() []Screen {
+	sr.RLock()
+	defer sr.RUnlock()
+
+	screens := make([]Screen, 0, len(sr.screens))
+	for _, screen := range sr.screens {
+		screens = append(screens, *screen)
+	}
+	sort.Sort(byOnlineAndName(screens))
+	return screens
+}
+
+// events builds the widget events of the built-in screens dashboard.
+func (sr *screenRegistry) events() []*Event {
+	var online, offline int
+	items := []map[string]interface{}{}
+
+	for _, screen := range sr.list() {
+		var value string
+		if screen.Online {
+			online++
+			value = fmt.Sprintf("%s - seen %s", screen.Dashboard, screen.LastWrite.Format("Jan 2 15:04:05"))
+		} else {
+			offline++
+			value = fmt.Sprintf("offline since %s", screen.OfflineSince.Format("Jan 2 15:04:05"))
+		}
+		items = append(items, map[string]interface{}{
+			"label": screen.Name,
+			"value": value,
+		})
+	}
+
+	offlineStatus := "normal"
+	if offline > 0 {
+		offlineStatus = "warning"
+	}
+
+	return []*Event{
+		NewEvent(screenWidgets[0], map[string]interface{}{"items": items}, ""),
+		NewEvent(screenWidgets[1], map[string]interface{}{"current": online}, ""),
+		NewEvent(screenWidgets[2], map[string]interface{}{"current": offline, "status": offlineStatus}, ""),
+	}
+}
+
+type byOnlineAndName []Screen
+
+func (s byOnlineAndName) Len() int      { return len(s) }
+func (s byOnlineAndName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byOnlineAndName) Less(i, j int) bool {
+	if s[i].Online != s[j].Online {
+		return s[i].Online
+	}
+	return s[i].Name < s[j].Name
+}
+
+// refererDashboard returns the dashboard path a request was made from.
+func refererDashboard(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(u.Path, "/")
+}
@@ -0,0 +1,190 @@
+package dashing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientIdentity(t *testing.T) {
+	tests := []struct {
+		client client
+		key    string
+		name   string
+	}{
+		{client{screen: "lobby", id: "0123456789abcdef", remoteAddr: "10.0.0.1:5000"}, "lobby", "lobby"},
+		{client{id: "0123456789abcdef", remoteAddr: "10.0.0.1:5000"}, "dashing_client:0123456789abcdef", "10.0.0.1 #012345"},
+		{client{id: "fedcba9876543210", remoteAddr: "10.0.0.1:5001"}, "dashing_client:fedcba9876543210", "10.0.0.1 #fedcba"},
+		{client{id: "0123456789abcdef", remoteAddr: "pipe"}, "dashing_client:0123456789abcdef", "pipe #012345"},
+	}
+	for _, tt := range tests {
+		if got := tt.client.key(); got != tt.key {
+			t.Errorf("key() = %q, want %q", got, tt.key)
+		}
+		if got := tt.client.name(); got != tt.name {
+			t.Errorf("name() = %q, want %q", got, tt.name)
+		}
+	}
+}
+
+func TestClientID(t *testing.T) {
+	w := httptest.NewRecorder()
+	id := clientID(w, httptest.NewRequest("GET", "/events", nil))
+	if len(id) != 16 {
+		t.Fatalf("new client id %q, want 16 hex digits", id)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != clientCookie || cookies[0].Value != id {
+		t.Fatalf("cookies %v, want %s=%s", cookies, clientCookie, id)
+	}
+
+	r := httptest.NewRequest("GET", "/events", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	if got := clientID(w, r); got != id {
+		t.Errorf("client id %q, want the one of the cookie %q", got, id)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("cookie set again")
+	}
+
+	r = httptest.NewRequest("GET", "/events", nil)
+	r.Header.Set("Cookie", clientCookie+"=abc")
+	if got := clientID(httptest.NewRecorder(), r); got == "abc" {
+		t.Errorf("a too short cookie is kept")
+	}
+}
+
+func TestScreenRegistry(t *testing.T) {
+	sr := newScreenRegistry()
+	lobby1 := &client{screen: "lobby", id: "0123456789abcdef", dashboard: "sales"}
+	lobby2 := &client{screen: "lobby", id: "fedcba9876543210", dashboard: "ops"}
+	unnamed1 := &client{id: "0123456789abcdef", remoteAddr: "10.0.0.1:5000"}
+	unnamed2 := &client{id: "fedcba9876543210", remoteAddr: "10.0.0.1:5001"}
+
+	for _, c := range []*client{lobby1, lobby2, unnamed1, unnamed2} {
+		sr.connect(c)
+	}
+	if got := len(sr.list()); got != 3 {
+		t.Fatalf("%d screens, want 3 : the lobby and two unnamed clients of a host", got)
+	}
+
+	sr.disconnect(lobby1)
+	sr.disconnect(unnamed1)
+	online := map[string]bool{}
+	for _, s := range sr.list() {
+		online[s.Name] = s.Online
+		if s.Name == "lobby" && s.Dashboard != "ops" {
+			t.Errorf("lobby dashboard %q, want the one of its last connection ops", s.Dashboard)
+		}
+	}
+	if !online["lobby"] || online["10.0.0.1 #012345"] || !online["10.0.0.1 #fedcba"] {
+		t.Errorf("online screens %v, want the lobby, still connected once, and 10.0.0.1 #fedcba", online)
+	}
+
+	sr.disconnect(lobby2)
+	sr.expire(time.Now().Add(screenRetention / 2))
+	if got := len(sr.list()); got != 3 {
+		t.Errorf("%d screens before the retention, want 3", got)
+	}
+	sr.expire(time.Now().Add(screenRetention + time.Minute))
+	list := sr.list()
+	if len(list) != 1 || list[0].Name != "10.0.0.1 #fedcba" {
+		t.Errorf("screens %v after the retention, want the online one only", list)
+	}
+
+	sr.connect(lobby1)
+	if list := sr.list(); len(list) != 2 || !list[0].Online || !list[1].Online {
+		t.Errorf("screens %v, want the lobby back online", list)
+	}
+}
+
+func TestReservedScreenWidgets(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+	s.validation = ValidationOff
+
+	tests := []struct {
+		id       string
+		reserved bool
+	}{
+		{"_screens", true},
+		{"_screens_online", true},
+		{"_screens_offline", true},
+		{"_sales", false},
+		{"screens", false},
+		{"_screens_total", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ok := s.validWidgetData(w, httptest.NewRequest("POST", "/widgets/"+tt.id, nil), "", tt.id, map[string]interface{}{})
+		if ok == tt.reserved || tt.reserved && w.Code != 403 {
+			t.Errorf("%s : accepted %v, status %d, want reserved %v", tt.id, ok, w.Code, tt.reserved)
+		}
+	}
+}
+
+func TestScreenName(t *testing.T) {
+	tests := []struct {
+		url    string
+		cookie string
+		want   string
+	}{
+		{"/events?screen=lobby-tv", "", "lobby-tv"},
+		{"/events?screen=lobby-tv", "noc", "lobby-tv"},
+		{"/events", "noc", "noc"},
+		{"/events", "", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "screen", Value: tt.cookie})
+		}
+		if got := screenName(r); got != tt.want {
+			t.Errorf("screenName(%s, cookie %q) = %q, want %q", tt.url, tt.cookie, got, tt.want)
+		}
+	}
+}
+
+func TestScreenCommands(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+	s.broker = NewBroker()
+	router := s.NewRouter()
+
+	lobby := &client{events: make(chan *Event, 10), screen: "lobby-tv"}
+	noc := &client{events: make(chan *Event, 10), screen: "noc"}
+	unnamed := &client{events: make(chan *Event, 10)}
+	for _, c := range []*client{lobby, noc, unnamed} {
+		s.broker.clients[c] = true
+	}
+
+	for _, body := range []string{`{"event": "reload"}`, `{"event": "reload", "dashboard": "sales"}`} {
+		events := make(chan *Event, 1)
+		go func() { events <- <-s.broker.events }()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/screens/lobby-tv/commands", strings.NewReader(body)))
+		if w.Code != 204 {
+			t.Fatalf("%s : status %d, want 204", body, w.Code)
+		}
+		s.broker.broadcast(<-events)
+	}
+
+	if len(noc.events) != 0 || len(unnamed.events) != 0 {
+		t.Errorf("commands of lobby-tv sent to %d other screens, want none", len(noc.events)+len(unnamed.events))
+	}
+	for _, dashboard := range []string{"*", "sales"} {
+		if len(lobby.events) == 0 {
+			t.Fatalf("command for %s not sent to lobby-tv", dashboard)
+		}
+		e := <-lobby.events
+		if e.Target != "dashboards" || e.Body["dashboard"] != dashboard {
+			t.Errorf("command %s for %v, want a dashboards command for %s", e.Target, e.Body["dashboard"], dashboard)
+		}
+	}
+	if _, ok := s.broker.cache["lobby-tv"]; ok {
+		t.Errorf("screen command cached, it would be replayed")
+	}
+}
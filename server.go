@@ -4,19 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"path"
 	"sort"
+	"sync"
+	"time"
 
 	"path/filepath"
 	"regexp"
 	"strings"
 
-	"github.com/GeertJohan/go.rice"
-	"github.com/GeertJohan/go.rice/embedded"
 	"github.com/clbanning/mxj"
 	"github.com/husobee/vestigo"
 	"gopkg.in/karlseguin/gerb.v0"
@@ -26,7 +24,26 @@ import (
 type Server struct {
 	dev     bool
 	webroot string
+	// prefix is the path prefix of a tenant, prepended to the urls of the
+	// pages
+	prefix  string
 	broker  *Broker
+	cache   *cache
+	history *History
+	// validation is the handling of the widget data not matching their
+	// schema, one of the Validation constants
+	validation string
+	// uploadMaxSize is the size in bytes of the largest file accepted by
+	// the uploads
+	uploadMaxSize int64
+	// overlay and staticCache are the asset layers and the cache policy
+	// of the public files, read once from the conf folder by loadConf
+	overlay     *AssetOverlay
+	staticCache CachePolicy
+	confOnce    sync.Once
+	// writes serializes the changes of the dashboards, each one checking
+	// their current content before writing them
+	writes sync.Mutex
 }
 
 func param(r *http.Request, name string) string {
@@ -51,18 +68,43 @@ func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a new channel, over which the broker can
-	// send this client events.
-	events := make(chan *Event)
+	// The dashboards of a tenant are below its prefix
+	dashboard := strings.TrimPrefix(refererDashboard(r.Referer()), strings.TrimPrefix(s.prefix+"/", "/"))
+
+	// The dashboards name the namespace of their widget IDs
+	namespace := r.URL.Query().Get("namespace")
+	if namespace != "" && !nameRegex.MatchString(namespace) {
+		log.Printf("404 - %s - %s\n", "namespaces", namespace)
+		namespace = ""
+	}
+
+	// Create a new client, with a channel over which the broker
+	// can send it events.
+	client := &client{
+		events:     make(chan *Event),
+		screen:     screenName(r),
+		id:         clientID(w, r),
+		remoteAddr: r.RemoteAddr,
+		userAgent:  r.UserAgent(),
+		dashboard:  dashboard,
+		namespace:  namespace,
+	}
 
 	// Add this client to the map of those that should
 	// receive updates
-	s.broker.newClients <- events
+	s.broker.newClients <- client
 
 	// Remove this client from the map of attached clients
-	// when the handler exits.
+	// when the handler exits, the broker may be pushing
+	// an event to it meanwhile.
 	defer func() {
-		s.broker.defunctClients <- events
+		for {
+			select {
+			case s.broker.defunctClients <- client:
+				return
+			case <-client.events:
+			}
+		}
 	}()
 
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -71,9 +113,14 @@ func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Accel-Buffering", "no")
 	closer := c.CloseNotify()
 
+	// Write a comment from time to time, so that a frozen screen shows up
+	// in the screens registry even when no event is sent.
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
 	for {
 		select {
-		case event := <-events:
+		case event := <-client.events:
 			json, err := mxj.Map(event.Body).Json()
 			if err != nil {
 				continue
@@ -81,8 +128,17 @@ func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
 			if event.Target != "" {
 				fmt.Fprintf(w, "event: %s\n", event.Target)
 			}
-			fmt.Fprintf(w, "data: %s\n\n", json)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", json); err != nil {
+				return
+			}
+			f.Flush()
+			s.broker.screens.seen(client)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
 			f.Flush()
+			s.broker.screens.seen(client)
 		case <-closer:
 			// log.Println("Closing connection")
 			return
@@ -96,50 +152,39 @@ const (
 	locationFS
 )
 
+// fileGetContent returns a file of a kind of assets, from the first layer of
+// the overlay having it, and whether it is embedded or on disk.
 func (s *Server) fileGetContent(path string, boxName string) (string, int, error) {
-	var fileContent string
-	var err error
-	var box *rice.Box
-
-	fullpath := filepath.Join(s.webroot, boxName, path)
-
-	_, err = os.Stat(fullpath)
-	if err == nil {
-		var fileContentByte []byte
-		fileContentByte, err = ioutil.ReadFile(fullpath)
-		if err != nil {
-			return "", locationFS, fmt.Errorf("Error while reading file %s: %s\n", fullpath, err.Error())
-		}
-		// log.Printf("(FS) %s", fullpath)
-		fileContent = string(fileContentByte)
-		return fileContent, locationFS, nil
+	content, layer, err := s.assets().ReadFile(boxName, path)
+	if err != nil {
+		return "", locationFS, fmt.Errorf("file %s not found in %s : %s\n", path, boxName, err.Error())
 	}
-
-	switch boxName {
-	case "public":
-		box, err = rice.FindBox("assets/public")
-	case "widgets":
-		box, err = rice.FindBox("assets/widgets")
-	case "dashboards":
-		box, err = rice.FindBox("assets/dashboards")
-	default:
-		panic("Unknow BOX")
+	if layer.Path == "" {
+		return string(content), locationBOX, nil
 	}
+	return string(content), locationFS, nil
+}
 
-	if err != nil {
-		return "", locationBOX, fmt.Errorf("Box %s not found : %s\n", boxName, err.Error())
+// DashboardEventHandler accepts dashboard events.
+func (s *Server) DashboardEventHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
 	}
 
-	fileContent, err = box.String(path)
-	if err != nil {
-		return "", locationBOX, fmt.Errorf("file %s not found in box : %s\n", path, boxName, err.Error())
+	var data map[string]interface{}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
 	}
 
-	return fileContent, locationBOX, err
+	s.broker.events <- NewEvent(param(r, "id"), data, "dashboards")
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// DashboardEventHandler accepts dashboard events.
-func (s *Server) DashboardEventHandler(w http.ResponseWriter, r *http.Request) {
+// ScreenCommandHandler accepts dashboards commands for a single screen.
+func (s *Server) ScreenCommandHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Body != nil {
 		defer r.Body.Close()
 	}
@@ -151,30 +196,98 @@ func (s *Server) DashboardEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.broker.events <- NewEvent(param(r, "id"), data, "dashboards")
+	if _, ok := data["dashboard"]; !ok {
+		data["dashboard"] = "*"
+	}
+
+	event := NewEvent(param(r, "name"), data, "dashboards")
+	event.Screen = param(r, "name")
+	s.broker.events <- event
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// WidgetEventHandler accepts widget data.
+// screenName returns the screen identity of a request, given by the "screen"
+// query parameter or remembered in the "screen" cookie.
+func screenName(r *http.Request) string {
+	if screen := r.URL.Query().Get("screen"); screen != "" {
+		return screen
+	}
+	if cookie, err := r.Cookie("screen"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// ScreensHandler lists the screens which are, or were, connected.
+func (s *Server) ScreensHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(s.broker.Screens())
+}
+
+// WidgetEventHandler accepts widget data, for the dashboards of a namespace
+// when one is given.
 func (s *Server) WidgetEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Body != nil {
 		defer r.Body.Close()
 	}
 
+	// The body is read first, param would parse it as a form otherwise
 	var data map[string]interface{}
-
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 		log.Printf("%v", err)
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
 
-	s.broker.events <- NewEvent(param(r, "id"), data, "")
+	// The path is /widgets/ID, or /widgets/NAMESPACE/ID
+	id, namespace := param(r, "_name"), ""
+	if i := strings.Index(id, "/"); i != -1 {
+		namespace, id = id[:i], id[i+1:]
+		if !nameRegex.MatchString(namespace) {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	if !s.validWidgetData(w, r, namespace, id, data) {
+		return
+	}
+
+	event := NewEvent(id, data, "")
+	event.Namespace = namespace
+	s.broker.events <- event
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// validWidgetData checks the data of a widget ID against the schemas of its
+// widgets, answering a 422 when they are rejected, and a 403 for the IDs
+// reserved to the server.
+func (s *Server) validWidgetData(w http.ResponseWriter, r *http.Request, namespace string, id string, data map[string]interface{}) bool {
+	if stringInSlice(id, screenWidgets) {
+		log.Printf("403 - %s - %s is reserved\n", r.URL.Path, id)
+		http.Error(w, "", http.StatusForbidden)
+		return false
+	}
+	if s.validation == ValidationOff {
+		return true
+	}
+	if errs := s.widgetSchemas().Validate(namespace, id, data); len(errs) > 0 {
+		if s.validation == ValidationStrict {
+			log.Printf("422 - %s - %s\n", r.URL.Path, joinFieldErrors(errs))
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+			return false
+		}
+		log.Printf("invalid data - %s - %s\n", r.URL.Path, joinFieldErrors(errs))
+	}
+	return true
+}
+
 var camelingRegex = regexp.MustCompile("[0-9A-Za-z]+")
 
 func CamelCase(src string) string {
@@ -188,39 +301,59 @@ func CamelCase(src string) string {
 	return string(bytes.Join(chunks, nil))
 }
 
+// A widgetTemplate is a parsed widget template, and where it was found.
+type widgetTemplate struct {
+	template gerb.TemplateChain
+	location int
+}
+
 // WidgetHandler serves widget templates.
 func (s *Server) WidgetHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
-
 	widget := param(r, "widget")
 	widget = widget[0 : len(widget)-5]
 
-	tplWidget, FSTYPE, err := s.fileGetContent(fmt.Sprintf("%s/%s.html", widget, widget), "widgets")
-
+	v, err := s.fromCache("widget:"+widget, func() (interface{}, error) {
+		return s.parseWidget(widget)
+	})
 	if err != nil {
-		// log.Printf("%v", err)
-		widget = CamelCase(widget)
-		tplWidget, FSTYPE, err = s.fileGetContent(fmt.Sprintf("%s/%s.html", widget, widget), "widgets")
-		if err != nil {
-			log.Printf("404 - %s - %s\n", "widgets", fmt.Sprintf("%s/%s.html", widget, widget))
-		}
+		s.serveTemplateError(w, r, err.(*templateError))
+		return
+	}
+	tpl := v.(*widgetTemplate)
 
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if tpl.location == locationBOX {
+		w.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d, public, must-revalidate, proxy-revalidate", 120))
 	}
 
-	template, err := gerb.ParseString(true, tplWidget)
+	tpl.template.Render(w, nil)
+}
 
-	if err != nil {
-		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
-		http.NotFound(w, r)
-		return
+// parseWidget parses the template of a widget, named as is or CamelCased.
+// The error is a *templateError.
+func (s *Server) parseWidget(widget string) (*widgetTemplate, error) {
+	lookups := []string{}
+	names := []string{widget}
+	if CamelCase(widget) != widget {
+		names = append(names, CamelCase(widget))
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-	if FSTYPE == locationBOX {
-		w.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d, public, must-revalidate, proxy-revalidate", 120))
+	for _, name := range names {
+		file := fmt.Sprintf("%s/%s.html", name, name)
+		tplWidget, FSTYPE, err := s.fileGetContent(file, "widgets")
+		if err != nil {
+			lookups = append(lookups, s.lookups(file, "widgets")...)
+			continue
+		}
+
+		template, err := gerb.ParseString(true, tplWidget)
+		if err != nil {
+			return nil, newTemplateError(http.StatusInternalServerError, err, templateFile{"widgets/" + file, tplWidget})
+		}
+		return &widgetTemplate{template, FSTYPE}, nil
 	}
 
-	template.Render(w, nil)
+	return nil, &templateError{status: http.StatusNotFound, file: fmt.Sprintf("widgets/%s/%s.html", widget, widget), err: fmt.Errorf("widget not found"), lookups: lookups}
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -232,167 +365,246 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-// WidgetsJSHandler serves widget templates.
+// WidgetsJSHandler serves the javascript of every widget, or of the widgets
+// of a dashboard.
 func (s *Server) WidgetsJSHandler(w http.ResponseWriter, r *http.Request) {
-
 	w.Header().Set("Content-Type", "application/javascript; charset=UTF-8")
-
-	//Disk
-	files, _ := filepath.Glob(s.webroot + "widgets/*/*.js")
-	for _, file := range files {
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			log.Printf(`Error while reading "%s" [%s]`, file, err)
-			continue
-		}
-		w.Write(content)
-		w.Write([]byte("\n\n\n"))
-	}
-
-	//BOX
-	for k, v := range embedded.EmbeddedBoxes["assets/widgets"].Files {
-		if filepath.Ext(k) == ".js" && !stringInSlice(s.webroot+"widgets/"+k, files) {
-			w.Write([]byte(v.Content))
-			w.Write([]byte("\n\n\n"))
-		}
-	}
+	s.serveWidgetsBundle(w, r, ".js")
 }
 
+// WidgetsCSSHandler serves the stylesheets of every widget, or of the
+// widgets of a dashboard.
 func (s *Server) WidgetsCSSHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/css; charset=UTF-8")
+	s.serveWidgetsBundle(w, r, ".css")
+}
 
-	//Disk
-	files, _ := filepath.Glob(s.webroot + "widgets/*/*.css")
-	for _, file := range files {
-		content, err := ioutil.ReadFile(file)
+// buildWidgetsBundle concatenates the widget files with the given extension,
+// the ones of a layer taking precedence over the ones of the next layers.
+func (s *Server) buildWidgetsBundle(ext string) []byte {
+	var content bytes.Buffer
+	views := []string{}
+	for _, w := range s.assets().widgets() {
+		views = append(views, w.Name)
+	}
+	content.Write(s.widgetDependencies(views, ext))
+
+	for _, f := range s.assets().Files("widgets", "") {
+		if path.Ext(f.Path) != ext || strings.Count(f.Path, "/") != 1 {
+			continue
+		}
+		c, _, err := s.assets().ReadFile("widgets", f.Path)
 		if err != nil {
-			log.Printf(`Error while reading "%s" [%s]`, file, err)
+			log.Printf(`Error while reading "%s" [%s]`, f.Path, err)
 			continue
 		}
-		w.Write(content)
-		w.Write([]byte("\n\n\n"))
+		content.Write(c)
+		content.WriteString("\n\n\n")
 	}
 
-	//BOX
-	for k, v := range embedded.EmbeddedBoxes["assets/widgets"].Files {
-		if filepath.Ext(k) == ".css" && !stringInSlice(s.webroot+"widgets/"+k, files) {
-			w.Write([]byte(v.Content))
-			w.Write([]byte("\n\n\n"))
+	return content.Bytes()
+}
+
+// A dashboardTemplate is a parsed dashboard, within its layout, and its
+// metadata.
+type dashboardTemplate struct {
+	template renderer
+	meta     DashboardMeta
+	files    []templateFile
+}
+
+// DashboardHandler serves the dashboard layout template.
+func (s *Server) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	// Dashboards can be nested in folders of any depth
+	dashboardpath := strings.TrimPrefix(r.URL.Path, "/")
+
+	switch {
+	case dashboardpath == "" || strings.HasSuffix(dashboardpath, "/"):
+		s.IndexHandler(w, r)
+		return
+	case path.Base(dashboardpath) == "events":
+		s.EventsHandler(w, r)
+		return
+	case path.Base(dashboardpath) == "export" && path.Dir(dashboardpath) != ".":
+		// Unless a dashboard is named export
+		if _, ok := s.findDashboard(dashboardpath); !ok {
+			s.ExportHandler(w, r)
+			return
 		}
 	}
 
-}
+	dashboard := path.Base(dashboardpath)
 
-func (s *Server) StaticHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
+	// A parameterised dashboard serves the paths below its own
+	file, values := s.resolveDashboard(dashboardpath)
 
-	content, FSTYPE, err := s.fileGetContent(r.URL.Path[8:], "public")
+	v, err := s.fromCache("dashboard:"+file, func() (interface{}, error) {
+		return s.parseDashboard(file)
+	})
 	if err != nil {
-		log.Printf("404 - %s - %s\n", "public", r.URL.Path[8:])
-		http.NotFound(w, r)
+		terr := err.(*templateError)
+		if terr.status == http.StatusNotFound && terr.file == "dashboards/"+dashboardpath+s.dashboardExt(dashboardpath) {
+			if _, _, err := s.assets().Open("dashboards", dashboardpath); err != nil {
+				http.Redirect(w, r, fmt.Sprintf("%s/%s/", s.prefix, dashboardpath), http.StatusTemporaryRedirect)
+				return
+			}
+		}
+		s.serveTemplateError(w, r, terr)
 		return
 	}
+	tpl := v.(*dashboardTemplate)
 
-	switch path.Ext(r.URL.Path) {
-	case ".css":
-		w.Header().Set("Content-Type", "text/css; charset=UTF-8")
-	case ".js":
-		w.Header().Set("Content-Type", "application/javascript; charset=UTF-8")
-	case ".ttf":
-		w.Header().Set("Content-Type", "application/x-font-ttf")
-	default:
-		w.Header().Set("Content-Type", "application/octet-stream")
+	params, err := tpl.meta.paramValues(values, r.URL.Query())
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "dashboards", err.Error())
+		http.NotFound(w, r)
+		return
 	}
 
-	if FSTYPE == locationBOX {
-		w.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d, public, must-revalidate, proxy-revalidate", 120))
+	hasNext, nextDashboardName := s.getNextDashboardName(dashboardpath)
+	nextname := nextDashboardName
+	refresh := defaultDuration
+	if tpl.meta.Duration > 0 {
+		refresh = tpl.meta.Duration
 	}
 
-	w.Write([]byte(content))
-}
+	// A screen following a playlist rotates according to it.
+	if name := r.URL.Query().Get("playlist"); name != "" {
+		playlist, err := s.getPlaylist(name)
+		if err != nil {
+			log.Printf("404 - %s - %s\n", "playlists", err.Error())
+		} else {
+			if current, ok := playlist.Current(dashboardpath); ok {
+				refresh = current.Duration
+			}
+			next, ok := s.getNextPlaylistEntry(playlist, dashboardpath)
+			hasNext = ok
+			nextname = playlist.URL(next)
+		}
+	}
 
-// DashboardHandler serves the dashboard layout template.
-func (s *Server) DashboardHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var tplDashboard string
-	var tplLayout string
+	// Remember the screen identity, so that it survives the rotation and
+	// is sent along with the events connection.
+	if screen := r.URL.Query().Get("screen"); screen != "" {
+		http.SetCookie(w, &http.Cookie{Name: "screen", Value: screen, Path: "/", MaxAge: 10 * 365 * 24 * 3600})
+	}
 
-	dashboard := param(r, "dashboard")
-	folder := param(r, "sub")
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
-	if dashboard == "" {
-		dashboard = fmt.Sprintf("events%s", param(r, "suffix"))
+	err = tpl.template.render(w, s.withHelpers(paramsContext(map[string]interface{}{
+		"dashboard":   dashboard,
+		"template":    file,
+		"prefix":      s.prefix,
+		"development": s.dev,
+		"request":     r,
+		"next":        hasNext,
+		"nextname":    nextname,
+		"refresh":     refresh,
+		"meta":        tpl.meta,
+		// The layouts give it to the switcher, the server rotating the
+		// dashboards
+		"dashboardnames": "",
+		"theme":          s.getTheme(w, r, dashboardpath, tpl.meta),
+		"events":         s.eventsURL(dashboardpath),
+		"widgetsjs":      s.widgetsURL(file, ".js"),
+		"widgetscss":     s.widgetsURL(file, ".css"),
+	}, params)))
+	if err != nil {
+		s.serveTemplateError(w, r, newTemplateError(http.StatusInternalServerError, err, tpl.files...))
 	}
+}
 
-	if folder != "" {
-		folder, dashboard = dashboard, folder
-		folder = folder + "/"
+// getLayout returns the layout of a dashboard of a format, and its file :
+// layouts/NAME.ext when it names one, or when its folder.toml does, else the
+// nearest layout.ext walking up its folders. The error is a *templateError
+// telling the lookups tried.
+func (s *Server) getLayout(dashboardpath string, name string, ext string) (string, string, error) {
+	if name == "" {
+		name = s.getFolderSettings(dashboardpath).Layout
+	}
+	if name != "" {
+		file := "layouts/" + name + ext
+		if !nameRegex.MatchString(name) {
+			return "", "", &templateError{status: http.StatusInternalServerError, file: file, err: fmt.Errorf("invalid layout name %s", name)}
+		}
+		content, _, err := s.assets().ReadFile("layouts", name+ext)
+		if err != nil {
+			return "", "", &templateError{status: http.StatusInternalServerError, file: file, err: err, lookups: s.lookups(name+ext, "layouts")}
+		}
+		return string(content), file, nil
 	}
-	dashboardpath := folder + dashboard
 
-	tplDashboard, _, err = s.fileGetContent(fmt.Sprintf("%s.gerb", dashboardpath), "dashboards")
-	if err != nil {
-		fileInfo, err := os.Stat(s.webroot + "dashboards/" + dashboardpath)
-		if err != nil || fileInfo.IsDir() {
-			http.Redirect(w, r, fmt.Sprintf("/%s/", dashboardpath), http.StatusTemporaryRedirect)
-			return
+	lookups := []string{}
+	folder := path.Dir(dashboardpath)
+	for {
+		file := folder + "/layout" + ext
+		if folder == "." || folder == "/" {
+			file = "layout" + ext
 		}
-		log.Printf("404 - %s - %s\n", "dashboards", fmt.Sprintf("%s.gerb", dashboardpath))
-		http.NotFound(w, r)
-		return
+		if tplLayout, _, err := s.fileGetContent(file, "dashboards"); err == nil {
+			return tplLayout, "dashboards/" + file, nil
+		}
+		lookups = append(lookups, s.lookups(file, "dashboards")...)
+
+		if folder == "." || folder == "/" {
+			return "", "", &templateError{status: http.StatusInternalServerError, file: "dashboards/" + file, err: fmt.Errorf("layout not found"), lookups: lookups}
+		}
+		folder = path.Dir(folder)
 	}
+}
 
-	tplLayout, _, err = s.fileGetContent(folder+"layout.gerb", "dashboards")
+func (s *Server) parseDashboard(dashboardpath string) (*dashboardTemplate, error) {
+	ext := s.dashboardExt(dashboardpath)
+	file := "dashboards/" + dashboardpath + ext
+	source, _, err := s.fileGetContent(dashboardpath+ext, "dashboards")
 	if err != nil {
-		tplLayout, _, err = s.fileGetContent("layout.gerb", "dashboards")
-		if err != nil {
-			log.Printf("404 - %s - %s\n", "dashboards", "layout.gerb")
-			http.NotFound(w, r)
-			return
+		lookups := []string{}
+		for _, e := range dashboardExts {
+			lookups = append(lookups, s.lookups(dashboardpath+e, "dashboards")...)
 		}
+		return nil, &templateError{status: http.StatusNotFound, file: file, err: err, lookups: lookups}
 	}
 
-	template, err := gerb.ParseString(true, tplDashboard, tplLayout)
-
+	meta, tplDashboard, err := parseFrontMatter(source)
 	if err != nil {
-		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
-		http.NotFound(w, r)
-		return
+		return nil, &templateError{status: http.StatusInternalServerError, file: file, err: err, source: source}
 	}
 
-	hasNext, nextDashboardName := s.getNextDashboardName(dashboardpath)
+	tplLayout, layoutFile, err := s.getLayout(dashboardpath, meta.Layout, ext)
+	if err != nil {
+		return nil, err
+	}
+	files := []templateFile{{file, source}, {layoutFile, tplLayout}}
 
-	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	var template renderer
+	if ext == ".tmpl" {
+		// The lines of the front-matter are kept, for the errors to tell
+		// the lines of the file
+		tplDashboard = strings.Repeat("\n", strings.Count(source[:len(source)-len(tplDashboard)], "\n")) + tplDashboard
+		template, err = parseHTMLTemplate(file, layoutFile, tplLayout, tplDashboard)
+	} else {
+		var chain gerb.TemplateChain
+		chain, err = gerb.ParseString(true, tplDashboard, tplLayout)
+		template = gerbTemplate{chain}
+	}
+	if err != nil {
+		return nil, newTemplateError(http.StatusInternalServerError, err, files...)
+	}
 
-	template.Render(w, map[string]interface{}{
-		"dashboard":   dashboard,
-		"development": s.dev,
-		"request":     r,
-		"next":        hasNext,
-		"nextname":    folder + nextDashboardName,
-	})
+	return &dashboardTemplate{template, meta, files}, nil
 }
 
-func (s *Server) getNextDashboardName(path string) (bool, string) {
+func (s *Server) getNextDashboardName(dashboardpath string) (bool, string) {
 	hasNext := false
 	nextDashboardName := ""
-	currentDashboardName := ""
 
-	pathBlock := strings.SplitN(path, "/", 2)
-
-	if len(pathBlock) == 1 {
-		path = ""
-		currentDashboardName = pathBlock[0]
-	} else {
-		path = pathBlock[0] + "/"
-		currentDashboardName = pathBlock[1]
-	}
+	// Rotation is scoped to the folder of the dashboard
+	path, currentDashboardName := path.Split(dashboardpath)
 
 	dashboardNames := s.getDashboardNames(path)
 	if len(dashboardNames) < 2 {
 		return hasNext, nextDashboardName
 	}
-	hasNext = true
 
 	position := -1
 	for p, v := range dashboardNames {
@@ -401,11 +613,18 @@ func (s *Server) getNextDashboardName(path string) (bool, string) {
 			break
 		}
 	}
-	if position+1 < len(dashboardNames) {
-		nextDashboardName = dashboardNames[position+1]
-	} else {
-		nextDashboardName = dashboardNames[0]
+	// Built-in dashboards are not part of the rotation
+	if position == -1 {
+		return hasNext, nextDashboardName
+	}
+	hasNext = true
+
+	// Dashboards following the current one, in rotation order
+	candidates := []string{}
+	for i := 1; i < len(dashboardNames); i++ {
+		candidates = append(candidates, path+dashboardNames[(position+i)%len(dashboardNames)])
 	}
+	nextDashboardName = s.rotate(s.getRotationRules(), path+currentDashboardName, candidates)
 
 	return hasNext, nextDashboardName
 }
@@ -413,37 +632,112 @@ func (s *Server) getNextDashboardName(path string) (bool, string) {
 func (s *Server) getDashboardNames(basePath string) []string {
 	bdnames := []string{}
 
-	files, _ := filepath.Glob(s.webroot + "dashboards/" + basePath + "*.gerb")
+	files, _ := s.assets().ReadDir("dashboards", basePath)
 	for _, file := range files {
-		name := filepath.Base(file)
-		name = name[:len(name)-5]
-		if name != "layout" {
-			bdnames = append(bdnames, name)
+		if file.IsDir() || !IsDashboardFile(file.Name()) {
+			continue
 		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		if name == "layout" || strings.HasPrefix(name, "_") || stringInSlice(name, bdnames) {
+			continue
+		}
+		if s.getDashboardMeta(basePath + name).Hidden {
+			continue
+		}
+		bdnames = append(bdnames, name)
 	}
 	sort.Strings(bdnames)
 
 	return bdnames
 }
 
-// IndexHandler redirects to the default dashboard.
+// IndexHandler lists the dashboards and sub folders of a folder, optionally
+// filtered by tag.
 func (s *Server) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	path := ""
-	if dashboard := param(r, "dashboard"); dashboard != "" {
-		path = path + dashboard + "/"
-	}
+	folder := strings.TrimPrefix(r.URL.Path, "/")
+	tag := r.URL.Query().Get("tag")
 
-	files, _ := filepath.Glob(s.webroot + "dashboards/" + path + "*.gerb")
+	files, err := s.assets().ReadDir("dashboards", folder)
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "dashboards", folder)
+		http.NotFound(w, r)
+		return
+	}
 
+	folders := []string{}
+	dashboards := []DashboardMeta{}
+	tags := []string{}
+	seen := map[string]bool{}
 	for _, file := range files {
-		dashboardName := file[len(s.webroot+"dashboards/"+path) : len(file)-5]
-		if dashboardName != "layout" {
-			http.Redirect(w, r, fmt.Sprintf("/%s", path+dashboardName), http.StatusTemporaryRedirect)
-			return
+		name := file.Name()
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		if file.IsDir() {
+			folders = append(folders, name)
+			continue
 		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		if !IsDashboardFile(file.Name()) || name == "layout" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		meta := s.getDashboardMeta(folder + name)
+		if meta.Hidden {
+			continue
+		}
+		for _, t := range meta.Tags {
+			if !stringInSlice(t, tags) {
+				tags = append(tags, t)
+			}
+		}
+		if tag != "" && !stringInSlice(tag, meta.Tags) {
+			continue
+		}
+		dashboards = append(dashboards, meta)
+	}
+	sort.Strings(tags)
+
+	tplIndex, _, err := s.fileGetContent("_index.gerb", "dashboards")
+	if err != nil {
+		s.serveTemplateError(w, r, &templateError{status: http.StatusInternalServerError, file: "dashboards/_index.gerb", err: err, lookups: s.lookups("_index.gerb", "dashboards")})
+		return
 	}
 
-	http.NotFound(w, r)
+	tplLayout, layoutFile, err := s.getLayout(folder+"_index", "", ".gerb")
+	if err != nil {
+		s.serveTemplateError(w, r, err.(*templateError))
+		return
+	}
+
+	template, err := gerb.ParseString(true, tplIndex, tplLayout)
+	if err != nil {
+		s.serveTemplateError(w, r, newTemplateError(http.StatusInternalServerError, err, templateFile{"dashboards/_index.gerb", tplIndex}, templateFile{layoutFile, tplLayout}))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+
+	template.Render(w, s.withHelpers(map[string]interface{}{
+		"dashboard":   "_index",
+		"template":    "_index",
+		"prefix":      s.prefix,
+		"theme":       s.getTheme(w, r, folder+"_index", DashboardMeta{}),
+		"events":      s.prefix + "/events",
+		"widgetsjs":   s.prefix + "/widgets.js",
+		"widgetscss":  s.prefix + "/widgets.css",
+		"development": false,
+		"request":     r,
+		"next":        false,
+		"nextname":    "",
+		"refresh":     0,
+		"folder":      folder,
+		"folders":     folders,
+		"dashboards":  dashboards,
+		"tags":        tags,
+		"tag":         tag,
+	}))
 }
 
 // NewRouter creates a router with defaults.
@@ -459,23 +753,62 @@ func (s *Server) NewRouter() http.Handler {
 	r.Get("/events:suffix", s.DashboardHandler) // workaround for router edge case
 
 	r.Post("/dashboards/:id", s.DashboardEventHandler)
+	r.Get("/screens", s.ScreensHandler)
+	r.Post("/screens/:name/commands", s.ScreenCommandHandler)
 
 	r.Get("/views/:widget", s.WidgetHandler)
-	r.Post("/widgets/:id", s.WidgetEventHandler)
-
+	// The router can not name apart the first parameter of /widgets/:id and
+	// /widgets/:ns/:id, the handler splits the path
+	r.Post("/widgets/*", s.WidgetEventHandler)
+
+	r.Get("/public/uploads", s.UploadsHandler)
+	r.Post("/public/uploads", requireToken(s.UploadHandler))
+	r.Get("/public/uploads/:name", s.StaticHandler)
+	r.Add("HEAD", "/public/uploads/:name", s.StaticHandler)
+	r.Delete("/public/uploads/:name", requireToken(s.DeleteUploadHandler))
 	r.Get("/public/*", s.StaticHandler)
+	r.Add("HEAD", "/public/*", s.StaticHandler)
+
+	r.Get("/playlist/:name", s.PlaylistHandler)
+	r.Get("/themes/:name", s.ThemeHandler)
+
+	// The changes are refused until an api token is configured
+	r.Get("/api/dashboards", s.APIDashboardsHandler)
+	r.Get("/api/dashboards/*", s.APIDashboardHandler)
+	r.Put("/api/dashboards/*", requireToken(s.APIPutDashboardHandler))
+	r.Patch("/api/dashboards/*", requireToken(s.APIRenameDashboardHandler))
+	r.Delete("/api/dashboards/*", requireToken(s.APIDeleteDashboardHandler))
+	r.Put("/api/folders/*", requireToken(s.APIPutFolderHandler))
+	r.Patch("/api/folders/*", requireToken(s.APIRenameFolderHandler))
+	r.Delete("/api/folders/*", requireToken(s.APIDeleteFolderHandler))
+	r.Get("/api/widgets", s.APIWidgetsHandler)
+	r.Get("/api/assets", s.APIAssetsHandler)
+	r.Get("/api/history/*", s.APIHistoryHandler)
+	r.Post("/api/history/*", requireToken(s.APIRestoreHandler))
+	r.Get("/_editor", s.EditorHandler)
+	r.Get("/_export/*", s.ExportHandler)
+
+	// Layouts are saved from the browser in development mode only
+	if s.dev {
+		r.Post("/layouts/*", requireToken(s.LayoutHandler))
+	}
 
 	r.Get("/:dashboard", s.DashboardHandler)
-	r.Get("/:dashboard/", s.IndexHandler)
-	r.Get("/:dashboard/:sub", s.DashboardHandler)
+	// The router does not fall back on the wildcard once a path shares the
+	// start of /:d/events, DashboardHandler exports the dashboards
+	r.Get("/:dashboard/export", s.DashboardHandler)
+	r.Get("/:dashboard/*", s.DashboardHandler)
 	return r
 }
 
 // NewServer creates a Server instance.
 func NewServer(b *Broker) *Server {
 	return &Server{
-		dev:     false,
-		webroot: "",
-		broker:  b,
+		dev:           false,
+		webroot:       "",
+		broker:        b,
+		cache:         newCache(),
+		validation:    ValidationMode(),
+		uploadMaxSize: UploadMaxSize(),
 	}
 }
@@ -0,0 +1,84 @@
+package dashing
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNestedDashboards(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"dashboards/layout.gerb":              `root <%! yield %>`,
+		"dashboards/main.gerb":                `<div data-id="main"></div>`,
+		"dashboards/emea/layout.gerb":         `emea <%! yield %>`,
+		"dashboards/emea/paris/ops.gerb":      `<div data-id="paris-ops"></div>`,
+		"dashboards/emea/paris/sales.gerb":    `<div data-id="paris-sales"></div>`,
+		"dashboards/emea/paris/_hidden.gerb":  `<div></div>`,
+		"dashboards/emea/london/ops.gerb":     `<div data-id="london-ops"></div>`,
+		"dashboards/emea/london/q1/west.gerb": `<div data-id="west"></div>`,
+		"dashboards/apac/tokyo/ops.gerb":      `<div data-id="tokyo-ops"></div>`,
+	})
+	defer cleanup()
+	router := s.NewRouter()
+
+	pages := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/main", 200, `root <div data-id="main">`},
+		{"/emea/paris/ops", 200, `emea <div data-id="paris-ops">`},
+		{"/emea/london/q1/west", 200, `emea <div data-id="west">`},
+		{"/apac/tokyo/ops", 200, `root <div data-id="tokyo-ops">`},
+		{"/emea/paris", 307, ""},
+		{"/emea/paris/nope", 307, ""},
+		{"/emea/paris/", 200, "sales"},
+	}
+	for _, tt := range pages {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.url, w.Code, tt.status)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s : %q, want %q", tt.url, w.Body.String(), tt.body)
+		}
+	}
+
+	layouts := []struct {
+		dashboard string
+		file      string
+	}{
+		{"main", "dashboards/layout.gerb"},
+		{"emea/paris/ops", "dashboards/emea/layout.gerb"},
+		{"emea/london/q1/west", "dashboards/emea/layout.gerb"},
+		{"apac/tokyo/ops", "dashboards/layout.gerb"},
+	}
+	for _, tt := range layouts {
+		if _, file, err := s.getLayout(tt.dashboard, "", ".gerb"); err != nil || file != tt.file {
+			t.Errorf("layout of %s : %s, %v, want %s", tt.dashboard, file, err, tt.file)
+		}
+	}
+
+	rotations := []struct {
+		dashboard string
+		next      string
+	}{
+		{"emea/paris/ops", "emea/paris/sales"},
+		{"emea/paris/sales", "emea/paris/ops"},
+		{"emea/london/ops", ""},
+		{"emea/paris/_hidden", ""},
+	}
+	for _, tt := range rotations {
+		if _, next := s.getNextDashboardName(tt.dashboard); next != tt.next {
+			t.Errorf("next of %s is %q, want %q", tt.dashboard, next, tt.next)
+		}
+	}
+
+	want := []string{"apac/tokyo/ops.gerb", "emea/layout.gerb", "emea/london/ops.gerb", "emea/london/q1/west.gerb", "emea/paris/_hidden.gerb", "emea/paris/ops.gerb", "emea/paris/sales.gerb", "layout.gerb", "main.gerb"}
+	if got := s.dashboardFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("dashboardFiles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+package dashing
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// mimeTypes are the types of the extensions the mime table of the system
+// may miss, or give differently.
+var mimeTypes = map[string]string{
+	".js":    "application/javascript",
+	".json":  "application/json",
+	".map":   "application/json",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".ico":   "image/x-icon",
+	".ttf":   "application/x-font-ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".eot":   "application/vnd.ms-fontobject",
+}
+
+// mimeType returns the type of a file, from its extension.
+func mimeType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := mimeTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// contentType returns the Content-Type header of a file, the text ones
+// being UTF-8.
+func contentType(name string) string {
+	t := mimeType(name)
+	if !strings.Contains(t, "charset") && (strings.HasPrefix(t, "text/") || t == "application/javascript" || t == "application/json") {
+		t += "; charset=UTF-8"
+	}
+	return t
+}
+
+// A CachePolicy tells the browsers how long they may keep the public files,
+// set by conf/static.toml.
+type CachePolicy struct {
+	// MaxAge is the seconds the files on disk are fresh, 0 having them
+	// revalidated at each use
+	MaxAge int `toml:"max_age"`
+	// EmbeddedMaxAge is the seconds the embedded files are fresh
+	EmbeddedMaxAge int         `toml:"embedded_max_age"`
+	Rules          []CacheRule `toml:"rule"`
+}
+
+// A CacheRule sets how long the public files matching a pattern are fresh.
+type CacheRule struct {
+	// Pattern matches the path of a file in the public folder, or its name
+	// when it has no /, as path.Match does
+	Pattern   string
+	MaxAge    int `toml:"max_age"`
+	Immutable bool
+}
+
+// ReadCachePolicy returns the cache policy of conf/static.toml, the embedded
+// files being fresh for 2 minutes and the other ones revalidated at each use
+// by default.
+func ReadCachePolicy(webroot string) (CachePolicy, error) {
+	p := CachePolicy{EmbeddedMaxAge: 120}
+	if _, err := os.Stat(webroot + "conf/static.toml"); err != nil {
+		return p, nil
+	}
+	var conf CachePolicy
+	conf.EmbeddedMaxAge = p.EmbeddedMaxAge
+	if _, err := toml.DecodeFile(webroot+"conf/static.toml", &conf); err != nil {
+		return p, err
+	}
+
+	if conf.MaxAge < 0 || conf.EmbeddedMaxAge < 0 {
+		return p, fmt.Errorf("max ages can not be negative")
+	}
+	for i, rule := range conf.Rules {
+		if rule.Pattern == "" {
+			return p, fmt.Errorf("rule %d : a pattern is required", i+1)
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return p, fmt.Errorf("rule %s : %s", rule.Pattern, err)
+		}
+		if rule.MaxAge < 0 {
+			return p, fmt.Errorf("rule %s : the max age can not be negative", rule.Pattern)
+		}
+	}
+	return conf, nil
+}
+
+// cacheControl returns the Cache-Control header of a public file, of the
+// first rule matching it, else of the default of its layer.
+func (p CachePolicy) cacheControl(name string, embedded bool) string {
+	maxAge, immutable := p.MaxAge, false
+	if embedded {
+		maxAge = p.EmbeddedMaxAge
+	}
+	for _, rule := range p.Rules {
+		target := name
+		if !strings.Contains(rule.Pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(rule.Pattern, target); ok {
+			maxAge, immutable = rule.MaxAge, rule.Immutable
+			break
+		}
+	}
+
+	switch {
+	case maxAge == 0:
+		return "no-cache"
+	case immutable:
+		return fmt.Sprintf("max-age=%d, public, immutable", maxAge)
+	}
+	return fmt.Sprintf("max-age=%d, public, must-revalidate, proxy-revalidate", maxAge)
+}
+
+// cachePolicy returns the cache policy of the webroot.
+func (s *Server) cachePolicy() CachePolicy {
+	s.loadConf()
+	return s.staticCache
+}
+
+// embeddedETags are the ETags of the embedded public files, by name,
+// computed once as these files never change.
+var embeddedETags sync.Map
+
+// assetETag returns a strong ETag of a file, from its modification time and
+// size, or from its content when it has no modification time, as the
+// embedded ones.
+func assetETag(name string, embedded bool, f http.File, fi os.FileInfo) string {
+	if fi.ModTime().Unix() <= 0 {
+		if etag, ok := embeddedETags.Load(name); ok && embedded {
+			return etag.(string)
+		}
+		content, err := ioutil.ReadAll(f)
+		if _, serr := f.Seek(0, io.SeekStart); err == nil && serr == nil {
+			etag := etagOf(content)
+			if embedded {
+				embeddedETags.Store(name, etag)
+			}
+			return etag
+		}
+	}
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+// StaticHandler serves the files of the public folders of the asset layers,
+// answering the conditional and range requests.
+func (s *Server) StaticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/public/")
+
+	f, layer, err := s.assets().Open("public", name)
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "public", name)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		log.Printf("500 - %s - %s\n", "public", err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType(name))
+	w.Header().Set("ETag", assetETag(name, layer.Path == "", f, fi))
+	w.Header().Set("Cache-Control", s.cachePolicy().cacheControl(name, layer.Path == ""))
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
@@ -0,0 +1,179 @@
+package dashing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server of a temporary webroot holding the given
+// files, by path, and a function removing it.
+func newTestServer(t *testing.T, files map[string]string) (*Server, func()) {
+	webroot, err := ioutil.TempDir("", "webroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, webroot, files)
+	s := NewServer(nil)
+	s.webroot = webroot + string(filepath.Separator)
+	return s, func() { os.RemoveAll(webroot) }
+}
+
+func TestStaticHandler(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{"public/hello.txt": "hello world"})
+	defer cleanup()
+
+	get := func(name string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/public/"+name, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.StaticHandler(w, r)
+		return w
+	}
+	first := get("hello.txt", nil)
+	etag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("ETag %q and Last-Modified %q are required", etag, modified)
+	}
+	later := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"plain", nil, 200, "hello world"},
+		{"range", map[string]string{"Range": "bytes=0-4"}, 206, "hello"},
+		{"suffix range", map[string]string{"Range": "bytes=-5"}, 206, "world"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=50-60"}, 416, ""},
+		{"matching etag", map[string]string{"If-None-Match": etag}, 304, ""},
+		{"one of the etags", map[string]string{"If-None-Match": `"x", ` + etag}, 304, ""},
+		{"weak etag", map[string]string{"If-None-Match": "W/" + etag}, 304, ""},
+		{"other etag", map[string]string{"If-None-Match": `"x"`}, 200, "hello world"},
+		{"not modified", map[string]string{"If-Modified-Since": later}, 304, ""},
+		{"range of the current version", map[string]string{"Range": "bytes=0-4", "If-Range": etag}, 206, "hello"},
+		{"range of an old version", map[string]string{"Range": "bytes=0-4", "If-Range": `"x"`}, 200, "hello world"},
+	}
+	for _, tt := range tests {
+		w := get("hello.txt", tt.headers)
+		if w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s : body %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+
+	if w := get("missing.txt", nil); w.Code != 404 {
+		t.Errorf("missing file : status %d, want 404", w.Code)
+	}
+	if got := first.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" && got != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type %q, want text/plain", got)
+	}
+}
+
+func TestStaticHandlerEmbedded(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/public/js/application.js", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.StaticHandler(w, r)
+		return w
+	}
+	first := get(nil)
+	if first.Code != 200 {
+		t.Fatalf("status %d, want 200", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if w := get(map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("matching etag : status %d, want 304", w.Code)
+	}
+	if w := get(nil); w.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed to %q, want %q", w.Header().Get("ETag"), etag)
+	}
+	if got, want := first.Header().Get("Cache-Control"), "max-age=120, public, must-revalidate, proxy-revalidate"; got != want {
+		t.Errorf("Cache-Control %q, want %q", got, want)
+	}
+}
+
+// A memFile is an http.File of content, without modification time, as the
+// embedded files are.
+type memFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f memFile) Close() error                             { return nil }
+func (f memFile) Readdir(count int) ([]os.FileInfo, error) { return nil, nil }
+func (f memFile) Stat() (os.FileInfo, error)               { return f, nil }
+func (f memFile) Name() string                             { return f.name }
+func (f memFile) Mode() os.FileMode                        { return 0444 }
+func (f memFile) ModTime() time.Time                       { return time.Time{} }
+func (f memFile) IsDir() bool                              { return false }
+func (f memFile) Sys() interface{}                         { return nil }
+
+func TestAssetETag(t *testing.T) {
+	file := func(content string) memFile {
+		return memFile{bytes.NewReader([]byte(content)), "a.js"}
+	}
+	etag := func(name string, embedded bool, content string) string {
+		f := file(content)
+		return assetETag(name, embedded, f, f)
+	}
+
+	if got, want := etag("test/a.js", true, "one"), etagOf([]byte("one")); got != want {
+		t.Errorf("embedded file : ETag %q, want %q", got, want)
+	}
+	if got, want := etag("test/a.js", true, "two"), etagOf([]byte("one")); got != want {
+		t.Errorf("embedded file read again : ETag %q, want the first one %q", got, want)
+	}
+	if got, want := etag("test/a.js", false, "two"), etagOf([]byte("two")); got != want {
+		t.Errorf("file on disk without modification time : ETag %q, want %q", got, want)
+	}
+	f := file("one")
+	assetETag("test/b.js", true, f, f)
+	if n, _ := f.Read(make([]byte, 3)); n != 3 {
+		t.Errorf("the file is not read from its start once hashed")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	p := CachePolicy{
+		MaxAge:         0,
+		EmbeddedMaxAge: 120,
+		Rules: []CacheRule{
+			{Pattern: "*.woff2", MaxAge: 31536000, Immutable: true},
+			{Pattern: "img/*", MaxAge: 3600},
+		},
+	}
+	tests := []struct {
+		name     string
+		embedded bool
+		want     string
+	}{
+		{"js/app.js", false, "no-cache"},
+		{"js/app.js", true, "max-age=120, public, must-revalidate, proxy-revalidate"},
+		{"fonts/a.woff2", false, "max-age=31536000, public, immutable"},
+		{"img/logo.png", false, "max-age=3600, public, must-revalidate, proxy-revalidate"},
+		{"img/sub/logo.png", false, "no-cache"},
+	}
+	for _, tt := range tests {
+		if got := p.cacheControl(tt.name, tt.embedded); got != tt.want {
+			t.Errorf("cacheControl(%s, %v) = %q, want %q", tt.name, tt.embedded, got, tt.want)
+		}
+	}
+}
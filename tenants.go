@@ -0,0 +1,154 @@
+package dashing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A Tenant is a webroot served by a process serving several of them, with
+// its own dashboards, jobs, widgets, tokens and broker. The requests for it
+// are chosen by their Host header or by the prefix of their path.
+type Tenant struct {
+	Name    string
+	Webroot string
+	Hosts   []string
+	Prefix  string
+	// Token is given to the jobs of the tenant to push their events, and
+	// accepted as its "default" token
+	Token string
+}
+
+// ReadTenants returns the tenants of conf/tenants.toml, declared by
+// [[tenant]] tables. A relative webroot is relative to the webroot.
+func ReadTenants(webroot string) ([]Tenant, error) {
+	var conf struct {
+		Tenant []Tenant
+	}
+	if _, err := os.Stat(webroot + "conf/tenants.toml"); err != nil {
+		return nil, nil
+	}
+	if _, err := toml.DecodeFile(webroot+"conf/tenants.toml", &conf); err != nil {
+		return nil, err
+	}
+
+	for i, t := range conf.Tenant {
+		if t.Name == "" || t.Webroot == "" {
+			return nil, fmt.Errorf("tenant %d : a name and a webroot are required", i+1)
+		}
+		if len(t.Hosts) == 0 && t.Prefix == "" {
+			return nil, fmt.Errorf("tenant %s : a host or a prefix is required", t.Name)
+		}
+		if t.Prefix != "" && (!strings.HasPrefix(t.Prefix, "/") || strings.HasSuffix(t.Prefix, "/")) {
+			return nil, fmt.Errorf("tenant %s : the prefix must start with a / and not end with one", t.Name)
+		}
+		if !filepath.IsAbs(t.Webroot) {
+			t.Webroot = filepath.Join(webroot, t.Webroot)
+		}
+		conf.Tenant[i].Webroot = filepath.Clean(t.Webroot) + string(filepath.Separator)
+	}
+	return conf.Tenant, nil
+}
+
+// workerPath returns the path the jobs of a tenant push their events to, on
+// the loopback address : its prefix, or a path routed as its first host.
+func (t Tenant) workerPath() string {
+	if t.Prefix != "" {
+		return t.Prefix
+	}
+	return "/_tenants/" + url.PathEscape(t.Name)
+}
+
+// NewTenant sets up the event broker, workers and webservice of a tenant, its
+// jobs pushing their events to 127.0.0.1 through its worker path.
+func NewTenant(t Tenant, port string) *Dashing {
+	d := NewDashing(t.Webroot, port, t.Token)
+	d.Server.prefix = t.Prefix
+	d.Worker.url += t.workerPath()
+	return d
+}
+
+// A prefixHandler serves the requests below a prefix, as made to host when
+// it is set.
+type prefixHandler struct {
+	prefix  string
+	host    string
+	handler http.Handler
+}
+
+// A TenantRouter dispatches the requests to the handler of their tenant,
+// and the other ones to a default handler.
+type TenantRouter struct {
+	fallback http.Handler
+	hosts    map[string]http.Handler
+	prefixes []prefixHandler
+}
+
+// NewTenantRouter returns a router of tenants, serving the requests of no
+// tenant with fallback.
+func NewTenantRouter(fallback http.Handler) *TenantRouter {
+	return &TenantRouter{
+		fallback: fallback,
+		hosts:    map[string]http.Handler{},
+	}
+}
+
+// Add routes the requests of a tenant to its handler.
+func (t *TenantRouter) Add(tenant Tenant, h http.Handler) {
+	for _, host := range tenant.Hosts {
+		t.hosts[strings.ToLower(host)] = h
+	}
+	if tenant.Prefix != "" {
+		t.prefixes = append(t.prefixes, prefixHandler{tenant.Prefix, "", h})
+	} else {
+		// The jobs of a tenant with hosts only push to 127.0.0.1, their
+		// requests being served as made to its first host
+		t.prefixes = append(t.prefixes, prefixHandler{tenant.workerPath(), tenant.Hosts[0], h})
+	}
+	// The longest prefixes first
+	sort.Slice(t.prefixes, func(i, j int) bool {
+		return len(t.prefixes[i].prefix) > len(t.prefixes[j].prefix)
+	})
+}
+
+// ServeHTTP implements the HTTP Handler, the prefix of a tenant being removed
+// from the path of its requests.
+func (t *TenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if h, ok := t.hosts[strings.ToLower(host)]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	for _, p := range t.prefixes {
+		if r.URL.Path != p.prefix && !strings.HasPrefix(r.URL.Path, p.prefix+"/") {
+			continue
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, p.prefix)
+		r2.URL.RawPath = ""
+		if r2.URL.Path == "" {
+			r2.URL.Path = "/"
+		}
+		if p.host != "" {
+			r2.Host = p.host
+		}
+		p.handler.ServeHTTP(w, r2)
+		return
+	}
+
+	t.fallback.ServeHTTP(w, r)
+}
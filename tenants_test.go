@@ -0,0 +1,52 @@
+package dashing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantRouter(t *testing.T) {
+	// Each handler answers its name, the host and the path it was given
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", name, r.Host, r.URL.Path)
+		})
+	}
+	router := NewTenantRouter(handler("default"))
+	router.Add(Tenant{Name: "ops", Hosts: []string{"ops.example.com", "NOC.example.com"}}, handler("ops"))
+	router.Add(Tenant{Name: "sales", Prefix: "/sales"}, handler("sales"))
+	router.Add(Tenant{Name: "emea", Prefix: "/sales/emea", Hosts: []string{"emea.example.com"}}, handler("emea"))
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want string
+	}{
+		{"host", "ops.example.com", "/sample", "ops ops.example.com /sample"},
+		{"host with a port", "ops.example.com:8080", "/sample", "ops ops.example.com:8080 /sample"},
+		{"host in any case", "noc.EXAMPLE.com", "/sample", "ops noc.EXAMPLE.com /sample"},
+		{"host wins over prefix", "ops.example.com", "/sales/q1", "ops ops.example.com /sales/q1"},
+		{"prefix stripped", "dash.example.com", "/sales/q1", "sales dash.example.com /q1"},
+		{"prefix alone", "dash.example.com", "/sales", "sales dash.example.com /"},
+		{"prefix with a slash", "dash.example.com", "/sales/", "sales dash.example.com /"},
+		{"longest prefix", "dash.example.com", "/sales/emea/q1", "emea dash.example.com /q1"},
+		{"host of a tenant with a prefix", "emea.example.com", "/q1", "emea emea.example.com /q1"},
+		{"start of a prefix only", "dash.example.com", "/salesforce", "default dash.example.com /salesforce"},
+		{"unknown host", "other.example.com", "/sample", "default other.example.com /sample"},
+		{"worker path of a host tenant", "127.0.0.1:8080", "/_tenants/ops/widgets/load", "ops ops.example.com /widgets/load"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://"+tt.host+tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s : %s%s served as %q, want %q", tt.name, tt.host, tt.path, got, tt.want)
+		}
+		if r.URL.Path != tt.path {
+			t.Errorf("%s : the path of the request changed to %s", tt.name, r.URL.Path)
+		}
+	}
+}
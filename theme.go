@@ -0,0 +1,158 @@
+package dashing
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// folderSettings are the defaults of the dashboards of a folder and its sub
+// folders, read from the folder.toml of the folder.
+type folderSettings struct {
+	Layout    string
+	Theme     string
+	Namespace string
+}
+
+// getFolderSettings returns the settings of the folder of a dashboard, each
+// one coming from the nearest folder.toml defining it.
+func (s *Server) getFolderSettings(dashboardpath string) folderSettings {
+	v, _ := s.fromCache("folder:"+path.Dir(dashboardpath), func() (interface{}, error) {
+		return s.readFolderSettings(dashboardpath), nil
+	})
+	return v.(folderSettings)
+}
+
+// readFolderSettings reads the settings of the folder of a dashboard from
+// the folder.toml files of the folder and of its parents, found in the asset
+// layers.
+func (s *Server) readFolderSettings(dashboardpath string) folderSettings {
+	var settings folderSettings
+	folder := path.Dir(dashboardpath)
+	for {
+		file := path.Join(folder, "folder.toml")
+
+		var current folderSettings
+		if content, _, err := s.assets().ReadFile("dashboards", file); err == nil {
+			if _, err := toml.Decode(string(content), &current); err != nil {
+				log.Printf("Server : can not read config file %s : %s", "dashboards/"+file, err)
+			}
+		}
+		if settings.Layout == "" {
+			settings.Layout = current.Layout
+		}
+		if settings.Theme == "" {
+			settings.Theme = current.Theme
+		}
+		if settings.Namespace == "" {
+			settings.Namespace = current.Namespace
+		}
+
+		if folder == "." || folder == "/" {
+			return settings
+		}
+		folder = path.Dir(folder)
+	}
+}
+
+// nameRegex matches the names of the themes and of the named layouts.
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// themeExists tells whether themes/NAME.css or a themes/NAME folder exists.
+func (s *Server) themeExists(name string) bool {
+	if !nameRegex.MatchString(name) {
+		return false
+	}
+	if _, err := os.Stat(s.webroot + "themes/" + name + ".css"); err == nil {
+		return true
+	}
+	f, err := os.Stat(s.webroot + "themes/" + name)
+	return err == nil && f.IsDir()
+}
+
+// getTheme returns the theme of a dashboard : the one of the theme query
+// parameter or cookie of the screen, else the one of the dashboard, else the
+// one of its folder. "none" turns the theme of the screen off.
+func (s *Server) getTheme(w http.ResponseWriter, r *http.Request, dashboardpath string, meta DashboardMeta) string {
+	// The theme of a screen survives the rotation
+	theme := r.URL.Query().Get("theme")
+	if nameRegex.MatchString(theme) {
+		http.SetCookie(w, &http.Cookie{Name: "theme", Value: theme, Path: "/", MaxAge: 10 * 365 * 24 * 3600})
+	} else if cookie, err := r.Cookie("theme"); err == nil {
+		theme = cookie.Value
+	}
+	if theme == "none" {
+		theme = ""
+	}
+
+	for _, t := range []string{theme, meta.Theme, s.getFolderSettings(dashboardpath).Theme} {
+		if t == "" {
+			continue
+		}
+		if s.themeExists(t) {
+			return t
+		}
+		log.Printf("404 - %s - %s\n", "themes", t)
+	}
+	return ""
+}
+
+// buildTheme concatenates themes/NAME.css, or the css files of the
+// themes/NAME folder in the order of their names.
+func (s *Server) buildTheme(name string) ([]byte, error) {
+	if content, err := ioutil.ReadFile(s.webroot + "themes/" + name + ".css"); err == nil {
+		return content, nil
+	}
+
+	files, err := filepath.Glob(s.webroot + "themes/" + name + "/*.css")
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("theme %s not found", name)
+	}
+
+	var content bytes.Buffer
+	for _, file := range files {
+		c, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&content, "/* %s */\n", filepath.Base(file))
+		content.Write(c)
+		content.WriteString("\n")
+	}
+	return content.Bytes(), nil
+}
+
+// ThemeHandler serves the css bundle of a theme.
+func (s *Server) ThemeHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(param(r, "name"), ".css")
+	if !s.themeExists(name) {
+		log.Printf("404 - %s - %s\n", "themes", name)
+		http.NotFound(w, r)
+		return
+	}
+
+	v, err := s.fromCache("theme:"+name, func() (interface{}, error) {
+		content, err := s.buildTheme(name)
+		if err != nil {
+			return nil, err
+		}
+		return newBundle(content), nil
+	})
+	if err != nil {
+		log.Printf("404 - %s - %s\n", "themes", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=UTF-8")
+	v.(*bundle).serve(w, r)
+}
@@ -0,0 +1,236 @@
+package dashing
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/karlseguin/gerb.v0"
+)
+
+// dashboardExts are the extensions of the dashboard formats : gerb, and Go
+// html/template with block-based layouts. A .gerb file wins over a .tmpl one
+// of the same name.
+var dashboardExts = []string{".gerb", ".tmpl"}
+
+// IsDashboardFile tells whether a file is a dashboard, or a layout, of any
+// format.
+func IsDashboardFile(name string) bool {
+	return stringInSlice(filepath.Ext(name), dashboardExts)
+}
+
+// findDashboard returns the extension of the file of a dashboard, found in
+// the dashboards folder or embedded.
+func (s *Server) findDashboard(dashboardpath string) (string, bool) {
+	for _, ext := range dashboardExts {
+		if _, _, err := s.fileGetContent(dashboardpath+ext, "dashboards"); err == nil {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// dashboardExt returns the extension of the file of a dashboard, .gerb when
+// it does not exist yet.
+func (s *Server) dashboardExt(dashboardpath string) string {
+	if ext, ok := s.findDashboard(dashboardpath); ok {
+		return ext
+	}
+	return ".gerb"
+}
+
+// A renderer is a parsed dashboard, of any format.
+type renderer interface {
+	render(w io.Writer, data map[string]interface{}) error
+}
+
+type gerbTemplate struct {
+	gerb.TemplateChain
+}
+
+// A gerbLogger collects the runtime errors of the gerb dashboards being
+// rendered, by the goroutine rendering them, and logs the other ones. gerb
+// logs every error through a single logger, without the render it comes
+// from, and renders on the goroutine of its caller.
+type gerbLogger struct {
+	sync.Mutex
+	errors map[uint64]*[]string
+}
+
+var gerbLog = &gerbLogger{errors: map[uint64]*[]string{}}
+
+func init() {
+	gerb.Configure().Logger(gerbLog)
+}
+
+func (l *gerbLogger) Error(v ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	errors, ok := l.errors[goroutineID()]
+	if !ok {
+		log.Printf("Template : %s", fmt.Sprint(v...))
+		return
+	}
+	*errors = append(*errors, fmt.Sprint(v...))
+}
+
+// collect appends the errors logged by the current goroutine to errors, and
+// returns the function ending it. The render of a partial within a dashboard
+// keeps collecting for the dashboard.
+func (l *gerbLogger) collect(errors *[]string) func() {
+	id := goroutineID()
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.errors[id]; ok {
+		return func() {}
+	}
+	l.errors[id] = errors
+	return func() {
+		l.Lock()
+		delete(l.errors, id)
+		l.Unlock()
+	}
+}
+
+// goroutineID returns the id of the current goroutine, read from the header
+// of its stack trace : "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i != -1 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// render executes the dashboard within its layout. The output is buffered,
+// so that nothing is written when the template fails.
+func (t gerbTemplate) render(w io.Writer, data map[string]interface{}) error {
+	var out bytes.Buffer
+	if err := t.execute(&out, data); err != nil {
+		return err
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// execute renders the dashboard, returning the runtime errors of the render.
+func (t gerbTemplate) execute(out io.Writer, data map[string]interface{}) (err error) {
+	errors := []string{}
+	defer gerbLog.collect(&errors)()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	t.Render(out, data)
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, ", "))
+	}
+	return nil
+}
+
+// An htmlTemplate is a .tmpl dashboard, defining the blocks of its layout.
+type htmlTemplate struct {
+	*template.Template
+}
+
+// parseHTMLTemplate parses a layout then a dashboard redefining its blocks,
+// like "title" and "content", each template being named by its file.
+func parseHTMLTemplate(name string, layoutName string, layout string, dashboard string) (*htmlTemplate, error) {
+	t, err := template.New(layoutName).Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.New(name).Parse(dashboard); err != nil {
+		return nil, err
+	}
+	return &htmlTemplate{t}, nil
+}
+
+// render executes the layout. The output is buffered, so that nothing is
+// written when the template fails.
+func (t *htmlTemplate) render(w io.Writer, data map[string]interface{}) error {
+	var out bytes.Buffer
+	if err := t.Execute(&out, htmlContext(data)); err != nil {
+		return err
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// htmlContext returns a copy of a render context for html/template, where
+// the helpers output markup.
+func htmlContext(data map[string]interface{}) map[string]interface{} {
+	context := map[string]interface{}{}
+	for k, v := range data {
+		context[k] = v
+	}
+	if h, ok := data["helpers"].(*helpers); ok {
+		context["helpers"] = htmlHelpers{h}
+	}
+	return context
+}
+
+// htmlHelpers are the helpers of the .tmpl templates, html/template escaping
+// any string they would return.
+type htmlHelpers struct {
+	*helpers
+}
+
+// Partial renders partials/NAME.gerb or partials/NAME.tmpl.
+func (h htmlHelpers) Partial(name string, args ...interface{}) template.HTML {
+	return template.HTML(h.helpers.Partial(name, args...))
+}
+
+// Widget returns the markup of a widget.
+func (h htmlHelpers) Widget(view string, id string, attrs ...interface{}) template.HTML {
+	return template.HTML(h.helpers.Widget(view, id, attrs...))
+}
+
+// JSON encodes a value in JSON, for a script.
+func (h htmlHelpers) JSON(value interface{}) template.JS {
+	return template.JS(h.helpers.JSON(value))
+}
+
+// renderHTMLPartial renders a .tmpl partial with a render context.
+func renderHTMLPartial(content string, context map[string]interface{}) (string, error) {
+	t, err := template.New("partial").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, htmlContext(context)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// expandHTMLDashboard renders the "content" block of a .tmpl dashboard, or
+// the dashboard itself when it has none.
+func expandHTMLDashboard(body string, context map[string]interface{}) (string, error) {
+	t, err := template.New("dashboard").Parse(body)
+	if err != nil {
+		return "", err
+	}
+	name := "dashboard"
+	if t.Lookup("content") != nil {
+		name = "content"
+	}
+
+	var out bytes.Buffer
+	if err := t.ExecuteTemplate(&out, name, htmlContext(context)); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
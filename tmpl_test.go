@@ -0,0 +1,68 @@
+package dashing
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/karlseguin/gerb.v0"
+)
+
+func TestGerbTemplateErrors(t *testing.T) {
+	parse := func(content string) gerbTemplate {
+		chain, err := gerb.ParseString(false, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gerbTemplate{chain}
+	}
+	valid, invalid := parse("<%= name %>"), parse("<%= missing.field %>")
+
+	var out bytes.Buffer
+	if err := invalid.render(&out, map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "undefined") {
+		t.Errorf("undefined value : error %v, want undefined", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("failed render : wrote %q, want nothing", out.String())
+	}
+
+	var wg sync.WaitGroup
+	failed := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			var out bytes.Buffer
+			if err := valid.render(&out, map[string]interface{}{"name": "a"}); err != nil {
+				failed <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var unlocked bytes.Buffer
+			invalid.Render(&unlocked, map[string]interface{}{})
+		}()
+	}
+	wg.Wait()
+	close(failed)
+	for err := range failed {
+		t.Errorf("valid render : error %v, from another render", err)
+	}
+	if n := len(gerbLog.errors); n != 0 {
+		t.Errorf("%d renders still collecting, want none", n)
+	}
+}
+
+func TestExpandDashboardErrors(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+
+	expanded, err := s.expandDashboard(`<div data-id="<%= env %>-<%= prefix %>"></div>`, ".gerb", map[string]string{"env": "prod"})
+	if err != nil || expanded != `<div data-id="prod-"></div>` {
+		t.Errorf("expandDashboard = %q, %v, want the values left undefined empty", expanded, err)
+	}
+	if n := len(gerbLog.errors); n != 0 {
+		t.Errorf("%d renders still collecting, want none", n)
+	}
+}
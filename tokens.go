@@ -0,0 +1,59 @@
+package dashing
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ReadTokens returns the named api tokens of conf/tokens.toml, where each
+// key is the name of a token, used as the author of the changes made with it.
+func ReadTokens(webroot string) (map[string]string, error) {
+	tokens := map[string]string{}
+	if _, err := os.Stat(webroot + "conf/tokens.toml"); err != nil {
+		return tokens, nil
+	}
+	if _, err := toml.DecodeFile(webroot+"conf/tokens.toml", &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+type authorKey struct{}
+
+// WithAuthor returns a shallow copy of r carrying the name of the token it
+// was authenticated with.
+func WithAuthor(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authorKey{}, name))
+}
+
+// author returns the name of the token a request was authenticated with.
+func author(r *http.Request) string {
+	if name, ok := r.Context().Value(authorKey{}).(string); ok {
+		return name
+	}
+	return "anonymous"
+}
+
+// authenticated tells whether a request was authenticated with an api token.
+func authenticated(r *http.Request) bool {
+	_, ok := r.Context().Value(authorKey{}).(string)
+	return ok
+}
+
+// requireToken refuses the requests not authenticated with an api token, so
+// that the dashboards, layouts and uploads can not be changed until a token
+// is configured.
+func requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authenticated(r) {
+			log.Printf("403 - %s - an api token is required\n", r.URL.Path)
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
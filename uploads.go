@@ -0,0 +1,265 @@
+package dashing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadTypes are the types of the uploaded files, detected from their
+// content, with their extension. SVG files are refused, as they can run
+// scripts.
+var uploadTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// uploadNameRegex matches the names of the uploaded files, the hash of their
+// content and their extension.
+var uploadNameRegex = regexp.MustCompile(`^[0-9a-f]{32}\.[a-z]+$`)
+
+// UploadMaxSize returns the size in bytes of the largest file accepted by the
+// uploads, set by the UPLOAD_MAX_SIZE env var as a number of bytes, or of
+// kilobytes or megabytes with a k or m suffix. It is 5m by default.
+func UploadMaxSize() int64 {
+	const defaultSize = 5 << 20
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("UPLOAD_MAX_SIZE")))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(v, "k"):
+		unit, v = 1<<10, strings.TrimSuffix(v, "k")
+	case strings.HasSuffix(v, "m"):
+		unit, v = 1<<20, strings.TrimSuffix(v, "m")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return defaultSize
+	}
+	return n * unit
+}
+
+// uploadExt returns the extension of an uploaded file, from its content, or
+// from its name for the text files. It is empty when the file is refused.
+func uploadExt(name string, content []byte) string {
+	t := http.DetectContentType(content)
+	if ext, ok := uploadTypes[t]; ok {
+		return ext
+	}
+	if !strings.HasPrefix(t, "text/plain") {
+		return ""
+	}
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".json":
+		if json.Valid(content) {
+			return ext
+		}
+	case ".csv", ".txt":
+		return ext
+	}
+	return ""
+}
+
+// An Upload is a file of the uploads folder.
+type Upload struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Size     int64     `json:"size"`
+	Type     string    `json:"type"`
+	Modified time.Time `json:"modified"`
+}
+
+// upload returns an uploaded file.
+func (s *Server) upload(f os.FileInfo) Upload {
+	return Upload{
+		Name:     f.Name(),
+		URL:      s.prefix + "/public/uploads/" + f.Name(),
+		Size:     f.Size(),
+		Type:     mimeType(f.Name()),
+		Modified: f.ModTime(),
+	}
+}
+
+// UploadHandler stores a file into public/uploads, named after the hash of
+// its content so that a file is stored once. The file is the "file" part of
+// a multipart form, or the body of the request. With a widget ID, the url of
+// the file is also pushed to the widget, as its "image" field or as the given
+// field, along with the fields of a JSON data object.
+func (s *Server) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	var name string
+	var content []byte
+	var err error
+	fields := r.URL.Query()
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.uploadMaxSize+1<<20)
+	if mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediatype == "multipart/form-data" {
+		if err := r.ParseMultipartForm(s.uploadMaxSize); err != nil {
+			log.Printf("400 - %s - %s\n", r.URL.Path, err.Error())
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		for k, v := range r.MultipartForm.Value {
+			fields[k] = v
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			log.Printf("400 - %s - %s\n", r.URL.Path, err.Error())
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		name = header.Filename
+		content, err = ioutil.ReadAll(io.LimitReader(file, s.uploadMaxSize+1))
+	} else {
+		name = fields.Get("name")
+		content, err = ioutil.ReadAll(io.LimitReader(r.Body, s.uploadMaxSize+1))
+	}
+	if err != nil {
+		log.Printf("400 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	if int64(len(content)) > s.uploadMaxSize {
+		log.Printf("413 - %s - %s is larger than %d bytes\n", r.URL.Path, name, s.uploadMaxSize)
+		http.Error(w, "", http.StatusRequestEntityTooLarge)
+		return
+	}
+	ext := uploadExt(name, content)
+	if ext == "" {
+		log.Printf("415 - %s - %s is a %s\n", r.URL.Path, name, http.DetectContentType(content))
+		http.Error(w, "", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// The data pushed along are checked before the file is stored
+	id, namespace := fields.Get("widget"), fields.Get("namespace")
+	data := map[string]interface{}{}
+	if id != "" {
+		if namespace != "" && !nameRegex.MatchString(namespace) {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if d := fields.Get("data"); d != "" {
+			if err := json.Unmarshal([]byte(d), &data); err != nil {
+				log.Printf("400 - %s - data : %s\n", r.URL.Path, err.Error())
+				http.Error(w, "", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	hash := sha256.Sum256(content)
+	filename := fmt.Sprintf("%x", hash[:16]) + ext
+	file := filepath.Join(s.webroot, "public", "uploads", filename)
+	field := fields.Get("field")
+	if field == "" {
+		field = "image"
+	}
+	data[field] = s.prefix + "/public/uploads/" + filename
+	if id != "" && !s.validWidgetData(w, r, namespace, id, data) {
+		return
+	}
+
+	status := http.StatusOK
+	if _, err := os.Stat(file); err != nil {
+		status = http.StatusCreated
+		if err := writeUpload(file, content); err != nil {
+			log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+	f, err := os.Stat(file)
+	if err != nil {
+		log.Printf("500 - %s - %s\n", r.URL.Path, err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if id != "" {
+		event := NewEvent(id, data, "")
+		event.Namespace = namespace
+		s.broker.events <- event
+	}
+
+	upload := s.upload(f)
+	w.Header().Set("Location", upload.URL)
+	writeJSON(w, status, upload)
+}
+
+// writeUpload writes an uploaded file, through a temporary file so that it
+// is never served partly written.
+func writeUpload(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".upload")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, bytes.NewReader(content)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// UploadsHandler lists the uploaded files, the last ones first.
+func (s *Server) UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	files, _ := ioutil.ReadDir(filepath.Join(s.webroot, "public", "uploads"))
+	uploads := []Upload{}
+	for _, f := range files {
+		if !f.IsDir() && uploadNameRegex.MatchString(f.Name()) {
+			uploads = append(uploads, s.upload(f))
+		}
+	}
+	sort.SliceStable(uploads, func(i, j int) bool {
+		return uploads[i].Modified.After(uploads[j].Modified)
+	})
+	writeJSON(w, http.StatusOK, uploads)
+}
+
+// DeleteUploadHandler deletes an uploaded file.
+func (s *Server) DeleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	name := param(r, "name")
+	if !uploadNameRegex.MatchString(name) {
+		log.Printf("404 - %s - %s\n", "uploads", name)
+		http.NotFound(w, r)
+		return
+	}
+	if err := os.Remove(filepath.Join(s.webroot, "public", "uploads", name)); err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("404 - %s - %s\n", "uploads", name)
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("500 - %s - %s\n", "uploads", err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package dashing
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestUploadExt(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"png", "a.bin", pngHeader, ".png"},
+		{"png named as a pdf", "a.pdf", pngHeader, ".png"},
+		{"jpeg", "a.jpg", "\xff\xd8\xff\xe0\x00\x10JFIF", ".jpg"},
+		{"gif", "a.gif", "GIF89a\x01\x00\x01\x00", ".gif"},
+		{"webp", "a.webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", ".webp"},
+		{"pdf", "a.pdf", "%PDF-1.4\n", ".pdf"},
+		{"json", "a.json", `{"a": 1}`, ".json"},
+		{"invalid json", "a.json", `{"a": `, ""},
+		{"csv", "a.CSV", "a,b\n1,2\n", ".csv"},
+		{"text", "a.txt", "hello", ".txt"},
+		{"text with another extension", "a.js", "alert(1)", ""},
+		{"svg", "a.svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, ""},
+		{"html", "a.txt", "<html><script>alert(1)</script></html>", ""},
+		{"binary", "a.png", "\x00\x01\x02\x03", ""},
+	}
+	for _, tt := range tests {
+		if got := uploadExt(tt.file, []byte(tt.content)); got != tt.want {
+			t.Errorf("%s : uploadExt(%s) = %q, want %q", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestUploadMaxSize(t *testing.T) {
+	defer os.Setenv("UPLOAD_MAX_SIZE", os.Getenv("UPLOAD_MAX_SIZE"))
+
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 5 << 20},
+		{"1000", 1000},
+		{"512k", 512 << 10},
+		{"20M", 20 << 20},
+		{" 2m ", 2 << 20},
+		{"0", 5 << 20},
+		{"-1k", 5 << 20},
+		{"1g", 5 << 20},
+		{"abc", 5 << 20},
+	}
+	for _, tt := range tests {
+		os.Setenv("UPLOAD_MAX_SIZE", tt.value)
+		if got := UploadMaxSize(); got != tt.want {
+			t.Errorf("UploadMaxSize() with %q = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUploadHandler(t *testing.T) {
+	s, cleanup := newTestServer(t, nil)
+	defer cleanup()
+	s.uploadMaxSize = 32
+
+	post := func(body string, contentType string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/public/uploads?name=a.txt", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.UploadHandler(w, r)
+		return w
+	}
+	multipartBody := func(name string, content string) (string, string) {
+		var b bytes.Buffer
+		m := multipart.NewWriter(&b)
+		f, _ := m.CreateFormFile("file", name)
+		f.Write([]byte(content))
+		m.Close()
+		return b.String(), m.FormDataContentType()
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		status      int
+	}{
+		{"new file", "hello", "text/plain", 201},
+		{"same file", "hello", "application/octet-stream", 200},
+		{"largest file", strings.Repeat("a", 32), "text/plain", 201},
+		{"file too large", strings.Repeat("a", 33), "text/plain", 413},
+		{"refused type", "<html></html>", "text/html", 415},
+	}
+	for _, tt := range tests {
+		if w := post(tt.body, tt.contentType); w.Code != tt.status {
+			t.Errorf("%s : status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	body, contentType := multipartBody("logo.png", pngHeader)
+	w := post(body, contentType)
+	if w.Code != 201 {
+		t.Fatalf("multipart : status %d, want 201", w.Code)
+	}
+	var upload Upload
+	if err := json.NewDecoder(w.Body).Decode(&upload); err != nil {
+		t.Fatal(err)
+	}
+	if !uploadNameRegex.MatchString(upload.Name) || !strings.HasSuffix(upload.Name, ".png") || upload.Type != "image/png" {
+		t.Errorf("multipart : upload %+v, want a png named after its hash", upload)
+	}
+	if w.Header().Get("Location") != upload.URL {
+		t.Errorf("multipart : Location %q, want %q", w.Header().Get("Location"), upload.URL)
+	}
+
+	body, contentType = multipartBody("big.txt", strings.Repeat("a", 33))
+	if w := post(body, contentType); w.Code != 413 {
+		t.Errorf("multipart file too large : status %d, want 413", w.Code)
+	}
+}
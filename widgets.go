@@ -0,0 +1,429 @@
+package dashing
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// widgetManifestFile is the manifest of a widget package, in its folder.
+const widgetManifestFile = "widget.toml"
+
+// A WidgetManifest describes a widget package.
+type WidgetManifest struct {
+	Name        string        `json:"name"`
+	Version     string        `json:"version"`
+	Description string        `json:"description"`
+	Author      string        `json:"author"`
+	Fields      []WidgetField `toml:"field" json:"fields"`
+	// Default size of the widget in a gridster layout
+	Size WidgetSize `json:"size"`
+	// Files of the public folder the widget needs, as js/d3.min.js
+	Dependencies []string `json:"dependencies"`
+}
+
+// A WidgetField is a field of the data of a widget.
+type WidgetField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// A WidgetSize is a number of gridster columns and rows, zero when the
+// manifest has none.
+type WidgetSize struct {
+	Sizex int `json:"sizex"`
+	Sizey int `json:"sizey"`
+}
+
+var (
+	widgetNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	versionRegex    = regexp.MustCompile(`^\d+\.\d+\.\d+(?:[-+][0-9A-Za-z.-]+)?$`)
+	fieldTypes      = []string{"", "string", "number", "integer", "boolean", "array", "object"}
+)
+
+// ReadWidgetManifest reads and validates the manifest of a widget folder.
+func ReadWidgetManifest(dir string) (*WidgetManifest, error) {
+	var m WidgetManifest
+	md, err := toml.DecodeFile(filepath.Join(dir, widgetManifestFile), &m)
+	if err != nil {
+		return nil, err
+	}
+	if md.IsDefined("size") && m.Size == (WidgetSize{}) {
+		return nil, fmt.Errorf("invalid size 0x0, expected positive sizex and sizey")
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate tells what is wrong with a manifest.
+func (m *WidgetManifest) Validate() error {
+	if !widgetNameRegex.MatchString(m.Name) {
+		return fmt.Errorf("invalid widget name %q", m.Name)
+	}
+	if !versionRegex.MatchString(m.Version) {
+		return fmt.Errorf("invalid version %q, expected MAJOR.MINOR.PATCH", m.Version)
+	}
+	names := []string{}
+	for _, f := range m.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("a field has no name")
+		}
+		if stringInSlice(f.Name, names) {
+			return fmt.Errorf("field %s is declared twice", f.Name)
+		}
+		if !stringInSlice(f.Type, fieldTypes) {
+			return fmt.Errorf("field %s has an invalid type %q", f.Name, f.Type)
+		}
+		names = append(names, f.Name)
+	}
+	if m.Size != (WidgetSize{}) && (m.Size.Sizex < 1 || m.Size.Sizey < 1) {
+		return fmt.Errorf("invalid size %dx%d, expected positive sizex and sizey", m.Size.Sizex, m.Size.Sizey)
+	}
+	for _, d := range m.Dependencies {
+		if d == "" || path.IsAbs(d) || path.Clean(d) != d || strings.HasPrefix(d, "../") {
+			return fmt.Errorf("invalid dependency %q, expected a path in the public folder", d)
+		}
+	}
+	return nil
+}
+
+// widgetDependencies concatenates the public files of a kind the manifests
+// of the given widget types depend on, each file once.
+func (s *Server) widgetDependencies(views []string, ext string) []byte {
+	keys := []string{}
+	for _, view := range views {
+		keys = append(keys, widgetKey(view))
+	}
+
+	var content bytes.Buffer
+	done := []string{}
+	for _, w := range s.assets().widgets() {
+		if w.Manifest == nil || !stringInSlice(widgetKey(w.Name), keys) {
+			continue
+		}
+		for _, d := range w.Manifest.Dependencies {
+			if path.Ext(d) != ext || stringInSlice(d, done) {
+				continue
+			}
+			done = append(done, d)
+			c, _, err := s.assets().ReadFile("public", d)
+			if err != nil {
+				log.Printf("Widgets : %s depends on public/%s : %s", w.Name, d, err)
+				continue
+			}
+			content.Write(c)
+			content.WriteString("\n\n\n")
+		}
+	}
+	return content.Bytes()
+}
+
+// widgetSize returns the size the manifest of a widget type gives, zero when
+// it has none.
+func (s *Server) widgetSize(view string) WidgetSize {
+	v, _ := s.fromCache("manifests", func() (interface{}, error) {
+		sizes := map[string]WidgetSize{}
+		for _, w := range s.assets().widgets() {
+			if w.Manifest != nil {
+				sizes[widgetKey(w.Name)] = w.Manifest.Size
+			}
+		}
+		return sizes, nil
+	})
+	return v.(map[string]WidgetSize)[widgetKey(view)]
+}
+
+// widgetKey returns the name under which the views of the dashboards find a
+// widget, the widgets with the same key shadowing each other.
+func widgetKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// A WidgetInfo is a widget type, found in one or more asset layers.
+type WidgetInfo struct {
+	Name     string `json:"name"`
+	Embedded bool   `json:"embedded"`
+	// Disk tells whether the widget is in the widgets folder of the webroot
+	Disk bool `json:"disk"`
+	// Layers are the asset layers having the widget, the first one serving
+	// it
+	Layers   []string        `json:"layers"`
+	Manifest *WidgetManifest `json:"manifest,omitempty"`
+}
+
+// ListWidgets lists the widget types of the asset layers of a webroot, with
+// the manifest of the installed ones.
+func ListWidgets(webroot string) []WidgetInfo {
+	return loadAssetOverlay(webroot).widgets()
+}
+
+// widgets lists the widget types of the layers, with the manifest of the
+// layer serving them.
+func (o *AssetOverlay) widgets() []WidgetInfo {
+	widgets := map[string]*WidgetInfo{}
+	for i, l := range o.Layers {
+		fs := l.FS("widgets")
+		if fs == nil {
+			continue
+		}
+		f, err := fs.Open("/")
+		if err != nil {
+			continue
+		}
+		dirs, _ := f.Readdir(-1)
+		f.Close()
+
+		for _, dir := range dirs {
+			if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+				continue
+			}
+			w, ok := widgets[dir.Name()]
+			if !ok {
+				w = &WidgetInfo{Name: dir.Name()}
+				widgets[dir.Name()] = w
+			}
+			w.Layers = append(w.Layers, l.Name)
+			if i == 0 {
+				w.Disk = true
+			}
+			if l.Path == "" {
+				w.Embedded = true
+				continue
+			}
+			file := filepath.Join(l.Path, "widgets", dir.Name(), widgetManifestFile)
+			if _, err := os.Stat(file); err == nil && len(w.Layers) == 1 {
+				m, err := ReadWidgetManifest(filepath.Dir(file))
+				if err != nil {
+					log.Printf("Widgets : invalid manifest %s : %s", l.location("widgets", dir.Name()+"/"+widgetManifestFile), err)
+				}
+				w.Manifest = m
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range widgets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []WidgetInfo{}
+	for _, name := range names {
+		list = append(list, *widgets[name])
+	}
+	return list
+}
+
+// InstallWidget installs the widget package of a folder, or of a .zip,
+// .tar.gz or .tgz archive, into the widgets folder of a webroot. An installed
+// widget with the same name, or one of the next asset layers, is replaced or
+// overridden only when force is set.
+func InstallWidget(webroot string, src string, force bool) (*WidgetManifest, error) {
+	dir := src
+	if f, err := os.Stat(src); err != nil {
+		return nil, err
+	} else if !f.IsDir() {
+		tmp, err := ioutil.TempDir("", "widget")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		if err := extractArchive(src, tmp); err != nil {
+			return nil, err
+		}
+		dir = tmp
+	}
+
+	// The package files are at the root of the archive, or in its only
+	// folder
+	if _, err := os.Stat(filepath.Join(dir, widgetManifestFile)); err != nil {
+		entries, _ := ioutil.ReadDir(dir)
+		if len(entries) != 1 || !entries[0].IsDir() {
+			return nil, fmt.Errorf("%s not found in %s", widgetManifestFile, src)
+		}
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+
+	m, err := ReadWidgetManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", widgetManifestFile, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, m.Name+".html")); err != nil {
+		return nil, fmt.Errorf("the package has no %s.html view", m.Name)
+	}
+
+	o := loadAssetOverlay(webroot)
+	for _, d := range m.Dependencies {
+		f, _, err := o.Open("public", d)
+		if err != nil {
+			return nil, fmt.Errorf("dependency public/%s not found", d)
+		}
+		f.Close()
+	}
+
+	var replaced []string
+	for _, w := range o.widgets() {
+		if widgetKey(w.Name) != widgetKey(m.Name) || force {
+			continue
+		}
+		for _, layer := range w.Layers {
+			switch layer {
+			case o.Layers[0].Name:
+				// The installed widgets are replaced below
+			case "embedded":
+				return nil, fmt.Errorf("%s conflicts with the embedded widget %s, force the install to override it", m.Name, w.Name)
+			default:
+				return nil, fmt.Errorf("%s conflicts with the widget %s of the %s layer, force the install to override it", m.Name, w.Name, layer)
+			}
+		}
+	}
+	dirs, _ := ioutil.ReadDir(webroot + "widgets")
+	for _, d := range dirs {
+		if !d.IsDir() || widgetKey(d.Name()) != widgetKey(m.Name) {
+			continue
+		}
+		if !force {
+			return nil, fmt.Errorf("%s conflicts with the installed widget widgets/%s, force the install to replace it", m.Name, d.Name())
+		}
+		replaced = append(replaced, filepath.Join(webroot, "widgets", d.Name()))
+	}
+	for _, d := range replaced {
+		if err := os.RemoveAll(d); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, copyDir(dir, filepath.Join(webroot, "widgets", m.Name))
+}
+
+// RemoveWidget removes an installed widget from the widgets folder of a
+// webroot, the widget it overrides in the next asset layers, if any, being
+// used again.
+func RemoveWidget(webroot string, name string) error {
+	dirs, _ := ioutil.ReadDir(webroot + "widgets")
+	for _, d := range dirs {
+		if d.IsDir() && widgetKey(d.Name()) == widgetKey(name) {
+			return os.RemoveAll(filepath.Join(webroot, "widgets", d.Name()))
+		}
+	}
+	for _, w := range loadAssetOverlay(webroot).widgets() {
+		if widgetKey(w.Name) != widgetKey(name) {
+			continue
+		}
+		if w.Embedded && len(w.Layers) == 1 {
+			return fmt.Errorf("%s is an embedded widget, it can not be removed", w.Name)
+		}
+		return fmt.Errorf("%s is a widget of the %s layer, it can not be removed", w.Name, w.Layers[0])
+	}
+	return fmt.Errorf("widget %s not found", name)
+}
+
+// extractArchive extracts a .zip, .tar.gz or .tgz archive into a folder,
+// refusing the entries outside of it.
+func extractArchive(archive string, dest string) error {
+	write := func(name string, mode os.FileMode, r io.Reader) error {
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid archive entry %s", name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, r)
+		return err
+	}
+
+	switch {
+	case strings.HasSuffix(archive, ".zip"):
+		z, err := zip.OpenReader(archive)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = write(f.Name, f.Mode(), rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasSuffix(archive, ".tar.gz"), strings.HasSuffix(archive, ".tgz"):
+		file, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+				continue
+			}
+			if err := write(h.Name, os.FileMode(h.Mode), tr); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("unsupported archive %s, expected a .zip, .tar.gz or .tgz", archive)
+}
+
+// copyDir copies the files of a folder into another one.
+func copyDir(src string, dest string) error {
+	return filepath.Walk(src, func(file string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, file)
+		if f.IsDir() {
+			return os.MkdirAll(filepath.Join(dest, rel), 0755)
+		}
+		if !f.Mode().IsRegular() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dest, rel), content, f.Mode().Perm()|0600)
+	})
+}
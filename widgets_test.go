@@ -0,0 +1,149 @@
+package dashing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadWidgetManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"minimal", "name = \"Gauge\"\nversion = \"1.0.0\"\n", ""},
+		{"size", "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\nsizex = 2\nsizey = 1\n", ""},
+		{"invalid name", "name = \"1Gauge\"\nversion = \"1.0.0\"\n", "invalid widget name"},
+		{"invalid version", "name = \"Gauge\"\nversion = \"1.0\"\n", "invalid version"},
+		{"field twice", "name = \"Gauge\"\nversion = \"1.0.0\"\n[[field]]\nname = \"a\"\n[[field]]\nname = \"a\"\n", "declared twice"},
+		{"field type", "name = \"Gauge\"\nversion = \"1.0.0\"\n[[field]]\nname = \"a\"\ntype = \"date\"\n", "invalid type"},
+		{"empty size", "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\n", "invalid size"},
+		{"zero size", "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\nsizex = 0\nsizey = 0\n", "invalid size"},
+		{"partial size", "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\nsizex = 2\n", "invalid size"},
+		{"negative size", "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\nsizex = -1\nsizey = 1\n", "invalid size"},
+		{"dependency outside", "name = \"Gauge\"\nversion = \"1.0.0\"\ndependencies = [\"../conf/a.js\"]\n", "invalid dependency"},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "manifest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, dir, map[string]string{widgetManifestFile: tt.manifest})
+		_, err = ReadWidgetManifest(dir)
+		os.RemoveAll(dir)
+		if err == nil && tt.err != "" || err != nil && (tt.err == "" || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s : error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestInstallWidget(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"conf/assets.toml":              "[[layer]]\nname = \"charts\"\npath = \"charts\"\nkinds = [\"widgets\"]\n",
+		"charts/widgets/Chart/Chart.js": "",
+		"public/js/d3.min.js":           "",
+	})
+	defer cleanup()
+
+	packages, err := ioutil.TempDir("", "packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(packages)
+	pkg := func(name string, files map[string]string) string {
+		writeFiles(t, filepath.Join(packages, name), files)
+		return filepath.Join(packages, name)
+	}
+	manifest := func(name string) string {
+		return "name = \"" + name + "\"\nversion = \"1.0.0\"\ndependencies = [\"js/d3.min.js\"]\n"
+	}
+
+	tests := []struct {
+		name  string
+		src   string
+		force bool
+		err   string
+	}{
+		{"new widget", pkg("gauge", map[string]string{"widget.toml": manifest("Gauge"), "Gauge.html": "", "Gauge.js": ""}), false, ""},
+		{"installed widget", pkg("gauge2", map[string]string{"widget.toml": manifest("gauge"), "gauge.html": ""}), false, "conflicts with the installed widget widgets/Gauge"},
+		{"installed widget forced", pkg("gauge3", map[string]string{"widget.toml": manifest("gauge"), "gauge.html": ""}), true, ""},
+		{"embedded widget", pkg("number", map[string]string{"widget.toml": manifest("Number"), "Number.html": ""}), false, "conflicts with the embedded widget number"},
+		{"embedded widget forced", pkg("number2", map[string]string{"widget.toml": manifest("Number"), "Number.html": ""}), true, ""},
+		{"widget of a layer", pkg("chart", map[string]string{"widget.toml": manifest("Chart"), "Chart.html": ""}), false, "conflicts with the widget Chart of the charts layer"},
+		{"package folder", pkg("meter", map[string]string{"Meter/widget.toml": manifest("Dial"), "Meter/Dial.html": ""}), false, ""},
+		{"no view", pkg("clock", map[string]string{"widget.toml": manifest("Clock")}), false, "no Clock.html view"},
+		{"missing dependency", pkg("map", map[string]string{"widget.toml": "name = \"Map\"\nversion = \"1.0.0\"\ndependencies = [\"js/leaflet.js\"]\n", "Map.html": ""}), false, "dependency public/js/leaflet.js not found"},
+		{"no manifest", pkg("empty", map[string]string{"a.html": "", "b.html": ""}), false, "widget.toml not found"},
+	}
+	for _, tt := range tests {
+		_, err := InstallWidget(s.webroot, tt.src, tt.force)
+		if err == nil && tt.err != "" || err != nil && (tt.err == "" || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s : error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	installed := []string{}
+	for _, w := range ListWidgets(s.webroot) {
+		if w.Disk {
+			installed = append(installed, w.Name)
+		}
+	}
+	if got, want := strings.Join(installed, " "), "Dial Number gauge"; got != want {
+		t.Errorf("installed widgets %q, want %q", got, want)
+	}
+}
+
+func TestRemoveWidget(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"conf/assets.toml":              "[[layer]]\nname = \"charts\"\npath = \"charts\"\nkinds = [\"widgets\"]\n",
+		"charts/widgets/Chart/Chart.js": "",
+		"widgets/Gauge/Gauge.html":      "",
+		"widgets/Number/Number.html":    "",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"gauge", ""},
+		{"Gauge", "not found"},
+		{"Number", ""},
+		{"Number", "embedded widget"},
+		{"Chart", "widget of the charts layer"},
+		{"Clock", "not found"},
+	}
+	for _, tt := range tests {
+		err := RemoveWidget(s.webroot, tt.name)
+		if err == nil && tt.err != "" || err != nil && (tt.err == "" || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("remove %s : error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestWidgetHelperSize(t *testing.T) {
+	s, cleanup := newTestServer(t, map[string]string{
+		"widgets/Gauge/widget.toml": "name = \"Gauge\"\nversion = \"1.0.0\"\n[size]\nsizex = 2\nsizey = 3\n",
+		"widgets/Gauge/Gauge.html":  "",
+	})
+	defer cleanup()
+	h := &helpers{server: s}
+
+	tests := []struct {
+		view  string
+		attrs []interface{}
+		want  string
+	}{
+		{"Gauge", nil, `<div data-id="a" data-view="Gauge" data-sizex="2" data-sizey="3"></div>`},
+		{"Gauge", []interface{}{"sizex", 1}, `<div data-id="a" data-view="Gauge" data-sizex="1" data-sizey="3"></div>`},
+		{"Number", nil, `<div data-id="a" data-view="Number"></div>`},
+	}
+	for _, tt := range tests {
+		if got := h.Widget(tt.view, "a", tt.attrs...); got != tt.want {
+			t.Errorf("Widget(%s, a, %v) = %s, want %s", tt.view, tt.attrs, got, tt.want)
+		}
+	}
+}
@@ -31,19 +31,31 @@ func (w *Worker) Start() {
 
 // NewWorker returns a Worker instance.
 func NewWorker(b *Broker) *Worker {
-	return &Worker{
-		broker:   b,
-		registry: append([]Job(nil), jobs...),
+	w := &Worker{
+		broker: b,
 	}
+	for _, f := range jobs {
+		w.registry = append(w.registry, f())
+	}
+	return w
 }
 
-// Global registry for background jobs.
-var jobs []Job
+// Global registry for background jobs, as functions returning them.
+var jobs []func() Job
 
 // Register a job to be kicked off upon starting a worker.
 func Register(j Job) {
 	if j == nil {
 		panic("Can't register nil job")
 	}
-	jobs = append(jobs, j)
+	jobs = append(jobs, func() Job { return j })
+}
+
+// RegisterFactory registers a job created anew for each worker, for the jobs
+// keeping a state to serve the workers of several tenants.
+func RegisterFactory(f func() Job) {
+	if f == nil {
+		panic("Can't register nil job factory")
+	}
+	jobs = append(jobs, f)
 }